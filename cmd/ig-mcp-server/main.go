@@ -21,13 +21,17 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
 
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/capture"
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/discoverer"
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/output"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/policy"
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/server"
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/tools"
 	lifecycledeploy "github.com/inspektor-gadget/ig-mcp-server/pkg/tools/lifecycle/deploy"
@@ -44,11 +48,17 @@ var (
 	transportPort = flag.String("transport-port", "8080", "port for the transport")
 	// Inspektor Gadget configuration
 	environment                   = flag.String("environment", "kubernetes", "environment to use (currently only 'kubernetes' or 'linux' is supported)")
-	linuxRemoteAddress            = flag.String("linux-remote-address", "unix:///var/run/ig/ig.socket", "Comma-separated list of remote address (gRPC) to connect (unix:///var/run/ig/ig.socket)")
+	linuxRemoteAddress            = flag.String("linux-remote-address", "unix:///var/run/ig/ig.socket", "Comma-separated list of remote addresses (gRPC) to connect (unix:///var/run/ig/ig.socket), gadgets run on all of them and events are tagged with their host")
 	gadgetNamespace               = flag.String("namespace", "", "namespace where Inspektor Gadget is deployed (auto-detected, falls back to 'gadget')")
 	gadgetImages                  = flag.String("gadget-images", "", "comma-separated list of gadget images to use (e.g. 'trace_dns:latest,trace_open:latest')")
 	gadgetDiscoverer              = flag.String("gadget-discoverer", "artifacthub", "gadget discoverer to use (artifacthub)")
 	artifactHubDiscovererOfficial = flag.Bool("artifacthub-official", true, "use only official gadgets from Artifact Hub")
+	resultBudget                  = flag.String("result-budget", output.DefaultBudget.String(), "maximum size of gadget results in bytes (e.g. 64kb) or estimated tokens (e.g. 16000tokens), larger results are sampled")
+	enableTools                   = flag.String("enable-tools", "", "comma-separated glob patterns of the tools to expose (e.g. 'ig_*,gadget_trace_*,!gadget_traceloop'), patterns prefixed with ! exclude tools")
+	disableTools                  = flag.String("disable-tools", "", "comma-separated glob patterns of tools not to expose (e.g. 'gadget_profile_*')")
+	toolMode                      = flag.String("tool-mode", tools.ToolModeFull, fmt.Sprintf("how gadgets are exposed (%s): one tool per gadget or the ig_catalog and ig_run tools", strings.Join(tools.ToolModes, ", ")))
+	policyFile                    = flag.String("policy", "", "YAML file with the policy tool calls are checked against, reloaded on SIGHUP")
+	captureDir                    = flag.String("capture-dir", "", "directory to write pcapng captures of raw packets to (defaults to ~/.cache/ig-mcp-server/captures)")
 	// Server configuration
 	logLevel    = flag.String("log-level", "", "log level (debug, info, warn, error)")
 	versionFlag = flag.Bool("version", false, "print version and exit")
@@ -85,6 +95,10 @@ func main() {
 		logFatal("invalid environment, must be 'kubernetes' or 'linux'", "environment", *environment)
 	}
 
+	if !slices.Contains(tools.ToolModes, *toolMode) {
+		logFatal("invalid tool mode", "tool_mode", *toolMode, "supported", tools.ToolModes)
+	}
+
 	if *logLevel != "" {
 		l, err := parseLogLevel(*logLevel)
 		if err != nil {
@@ -107,7 +121,20 @@ func main() {
 		}
 	}
 
-	mgr, err := gadgetmanager.NewGadgetManager(*environment, *linuxRemoteAddress, k8sConfig, namespace)
+	// packets are only captured if there is a place to store them
+	captures, err := capture.NewStore(*captureDir)
+	if err != nil {
+		log.Warn("Failed to create capture store, raw packets won't be captured", "error", err)
+		captures = nil
+	}
+	budget, err := output.ParseBudget(*resultBudget)
+	if err != nil {
+		logFatal("invalid result budget", "error", err)
+	}
+	mgr, err := gadgetmanager.NewGadgetManager(*environment, *linuxRemoteAddress, k8sConfig, namespace,
+		gadgetmanager.WithCaptureStore(captures),
+		gadgetmanager.WithResultBudget(budget),
+	)
 	if err != nil {
 		logFatal("failed to create gadget manager", "error", err)
 	}
@@ -118,8 +145,24 @@ func main() {
 			logFatal("failed to create gadget discoverer", "error", err)
 		}
 	}
-	registry := tools.NewToolRegistry(mgr, *environment, k8sConfig, dis, *readOnly)
-	srv := server.New(version, registry)
+	toolFilter, err := tools.ParseToolFilter(*enableTools, *disableTools)
+	if err != nil {
+		logFatal("invalid tool filter", "error", err)
+	}
+	var toolPolicy *policy.Policy
+	if *policyFile != "" {
+		toolPolicy, err = policy.Load(*policyFile)
+		if err != nil {
+			logFatal("invalid policy", "error", err)
+		}
+	}
+	registry := tools.NewToolRegistry(mgr, *environment, k8sConfig, dis, *readOnly,
+		tools.WithToolFilter(toolFilter),
+		tools.WithToolMode(*toolMode),
+		tools.WithPolicy(toolPolicy),
+		tools.WithGadgetNamespace(namespace),
+	)
+	srv := server.New(version, registry, captures)
 
 	var images []string
 	if gadgetImages != nil && *gadgetImages != "" {
@@ -128,6 +171,16 @@ func main() {
 	if err = registry.Prepare(ctx, images); err != nil {
 		logFatal("failed to prepare tool registry", "error", err)
 	}
+	// swap the tools once Inspektor Gadget becomes available or goes away
+	go func() {
+		if err := registry.Watch(ctx); err != nil {
+			log.Warn("Failed to watch Inspektor Gadget, tools won't be refreshed", "error", err)
+		}
+	}()
+
+	if *policyFile != "" {
+		go reloadPolicyOnSignal(ctx, *policyFile, registry)
+	}
 
 	go func() {
 		defer stop()
@@ -143,6 +196,28 @@ func main() {
 	}
 }
 
+// reloadPolicyOnSignal reloads the policy whenever the process receives SIGHUP. The
+// current policy is kept if the file is invalid.
+func reloadPolicyOnSignal(ctx context.Context, file string, registry *tools.GadgetToolRegistry) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			p, err := policy.Load(file)
+			if err != nil {
+				log.Error("Failed to reload policy, keeping the current one", "error", err)
+				continue
+			}
+			registry.SetPolicy(p)
+			log.Info("Reloaded policy", "file", file)
+		}
+	}
+}
+
 func logFatal(msg string, args ...any) {
 	log.Error(msg, args...)
 	os.Exit(1)
@@ -0,0 +1,293 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package capture writes raw packets emitted by gadgets to pcapng files that can
+// be opened with Wireshark or tcpdump.
+package capture
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/pcapgo"
+)
+
+const (
+	// URIScheme is the scheme of the MCP resources captures are exposed as
+	URIScheme = "capture://"
+	// MIMEType is the MIME type of the capture files
+	MIMEType = "application/x-pcapng"
+
+	fileExt = ".pcapng"
+	// maxCaptures is the number of capture files kept, older ones are removed
+	maxCaptures = 50
+	// maxCaptureSize is the size after which packets are no longer written to a capture
+	maxCaptureSize = 64 * 1024 * 1024 // 64mb
+)
+
+var log = slog.Default().With("component", "capture")
+
+// Store manages the capture files in a directory.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+	// open holds the names of the captures still being written to
+	open map[string]struct{}
+}
+
+// NewStore creates a store writing to dir, defaulting to ~/.cache/ig-mcp-server/captures.
+// The directory is only created once the first packet is written.
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("getting home dir: %w", err)
+		}
+		dir = filepath.Join(home, ".cache", "ig-mcp-server", "captures")
+	}
+	return &Store{dir: dir, open: make(map[string]struct{})}, nil
+}
+
+// create creates the file of a capture, which is kept from being pruned until it's
+// released.
+func (s *Store) create(name string) (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating capture dir: %w", err)
+	}
+	f, err := os.Create(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("creating capture file: %w", err)
+	}
+	s.open[name] = struct{}{}
+	return f, nil
+}
+
+// release allows a capture to be pruned once it was closed.
+func (s *Store) release(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.open, name)
+}
+
+// URI returns the resource URI of the capture with the given name.
+func URI(name string) string {
+	return URIScheme + name
+}
+
+// New returns a capture with the given name, the file is only created once the
+// first packet is written.
+func (s *Store) New(name string) *Capture {
+	return &Capture{
+		store:      s,
+		name:       name + fileExt,
+		interfaces: make(map[string]int),
+	}
+}
+
+// Read returns the content of the capture with the given name.
+func (s *Store) Read(name string) ([]byte, error) {
+	if name == "" || name != filepath.Base(name) || !strings.HasSuffix(name, fileExt) {
+		return nil, fmt.Errorf("invalid capture name %q", name)
+	}
+	buf, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("reading capture: %w", err)
+	}
+	return buf, nil
+}
+
+// prune removes the oldest capture files if there are more than maxCaptures.
+func (s *Store) prune() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Warn("Failed to list captures", "error", err)
+		return
+	}
+	type capture struct {
+		name    string
+		modTime time.Time
+	}
+	var captures []capture
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileExt) {
+			continue
+		}
+		// captures still being written to are never removed
+		if _, ok := s.open[e.Name()]; ok {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		captures = append(captures, capture{e.Name(), fi.ModTime()})
+	}
+	if len(captures) <= maxCaptures {
+		return
+	}
+	slices.SortFunc(captures, func(a, b capture) int { return a.modTime.Compare(b.modTime) })
+	for _, c := range captures[:len(captures)-maxCaptures] {
+		if err := os.Remove(filepath.Join(s.dir, c.name)); err != nil {
+			log.Warn("Failed to remove old capture", "name", c.name, "error", err)
+		}
+	}
+}
+
+// Capture is a single pcapng file, packets can be written to it from multiple goroutines.
+type Capture struct {
+	store *Store
+	name  string
+
+	mu         sync.Mutex
+	file       *os.File
+	w          *pcapgo.NgWriter
+	interfaces map[string]int
+	size       int64
+	packets    int
+	dropped    int
+	err        error
+}
+
+// WritePacket appends a packet captured at ts to the capture. Packets of different
+// sources (e.g. datasources or hosts) are recorded as different interfaces, named
+// after iface.
+func (c *Capture) WritePacket(iface string, linkType layers.LinkType, ts time.Time, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+	if c.size+int64(len(data)) > maxCaptureSize {
+		c.dropped++
+		return
+	}
+
+	id, ok := c.interfaces[iface]
+	if !ok {
+		var err error
+		id, err = c.addInterface(iface, linkType)
+		if err != nil {
+			c.err = err
+			log.Warn("Failed to write capture", "name", c.name, "error", err)
+			return
+		}
+	}
+
+	ci := gopacket.CaptureInfo{
+		Timestamp:      ts,
+		CaptureLength:  len(data),
+		Length:         len(data),
+		InterfaceIndex: id,
+	}
+	if err := c.w.WritePacket(ci, data); err != nil {
+		c.err = fmt.Errorf("writing packet: %w", err)
+		log.Warn("Failed to write capture", "name", c.name, "error", err)
+		return
+	}
+	c.size += int64(len(data))
+	c.packets++
+}
+
+func (c *Capture) addInterface(iface string, linkType layers.LinkType) (int, error) {
+	intf := pcapgo.DefaultNgInterface
+	intf.Name = iface
+	intf.LinkType = linkType
+	if c.w == nil {
+		f, err := c.store.create(c.name)
+		if err != nil {
+			return 0, err
+		}
+		w, err := pcapgo.NewNgWriterInterface(f, intf, pcapgo.DefaultNgWriterOptions)
+		if err != nil {
+			f.Close()
+			c.store.release(c.name)
+			return 0, fmt.Errorf("creating pcapng writer: %w", err)
+		}
+		c.file = f
+		c.w = w
+		c.interfaces[iface] = 0
+		go c.store.prune()
+		return 0, nil
+	}
+	id, err := c.w.AddInterface(intf)
+	if err != nil {
+		return 0, fmt.Errorf("adding interface: %w", err)
+	}
+	c.interfaces[iface] = id
+	return id, nil
+}
+
+// Close flushes the capture to disk. It's a no-op if no packet was written or the
+// capture was already closed.
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// packets arriving while the gadget is torn down are dropped
+	c.err = os.ErrClosed
+	if c.file == nil {
+		return nil
+	}
+	err := c.w.Flush()
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	c.file = nil
+	c.store.release(c.name)
+	if err != nil {
+		return fmt.Errorf("closing capture: %w", err)
+	}
+	return nil
+}
+
+// Summary returns a <capture> section describing where the capture can be
+// found, or an empty string if no packet was written. Pending packets are
+// flushed, so that the file can be opened while it's still being written.
+func (c *Capture) Summary() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.packets == 0 {
+		return ""
+	}
+	if c.file != nil {
+		if err := c.w.Flush(); err != nil {
+			log.Warn("Failed to flush capture", "name", c.name, "error", err)
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString("\n<capture>\n")
+	fmt.Fprintf(&sb, "<uri>%s</uri>\n", URI(c.name))
+	fmt.Fprintf(&sb, "<path>%s</path>\n", filepath.Join(c.store.dir, c.name))
+	fmt.Fprintf(&sb, "<packets>%d</packets>\n", c.packets)
+	if c.dropped > 0 {
+		fmt.Fprintf(&sb, "<droppedPackets>%d</droppedPackets>\n", c.dropped)
+	}
+	sb.WriteString("</capture>")
+	return sb.String()
+}
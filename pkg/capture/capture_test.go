@@ -0,0 +1,75 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestStoreCreatesDirLazily(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "captures")
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected the dir not to be created before a packet is written, got %v", err)
+	}
+
+	c := s.New("run")
+	c.WritePacket("eth0", layers.LinkTypeEthernet, time.Now(), []byte{1, 2, 3})
+	if err := c.Close(); err != nil {
+		t.Fatalf("closing capture: %v", err)
+	}
+	if _, err := s.Read("run" + fileExt); err != nil {
+		t.Errorf("expected the capture to be written, got %v", err)
+	}
+}
+
+func TestPruneSkipsOpenCaptures(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+	// the open capture is the oldest one
+	open := s.New("open")
+	open.WritePacket("eth0", layers.LinkTypeEthernet, time.Now(), []byte{1})
+	defer open.Close()
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(s.dir, "open"+fileExt), old, old); err != nil {
+		t.Fatalf("changing capture time: %v", err)
+	}
+	for i := range maxCaptures + 1 {
+		name := filepath.Join(s.dir, fmt.Sprintf("closed-%d%s", i, fileExt))
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatalf("writing capture: %v", err)
+		}
+	}
+
+	s.prune()
+	if _, err := os.Stat(filepath.Join(s.dir, "open"+fileExt)); err != nil {
+		t.Errorf("expected the open capture to be kept, got %v", err)
+	}
+	entries, _ := os.ReadDir(s.dir)
+	if len(entries) != maxCaptures+1 {
+		t.Errorf("expected %d captures to be kept next to the open one, got %d files", maxCaptures, len(entries))
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 
 	"github.com/distribution/reference"
 )
@@ -84,3 +85,14 @@ func FromImages(images []string) []Gadget {
 	}
 	return gadgets
 }
+
+// GadgetName returns the name of a gadget from its image, e.g. trace_dns for
+// ghcr.io/inspektor-gadget/gadget/trace_dns:latest.
+func GadgetName(image string) (string, error) {
+	ref, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("parsing image reference %s: %w", image, err)
+	}
+	name := reference.Path(ref)
+	return name[strings.LastIndex(name, "/")+1:], nil
+}
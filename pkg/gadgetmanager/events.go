@@ -0,0 +1,49 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gadgetmanager
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// tagEvent adds a string field as first field of a JSON encoded event.
+func tagEvent(key, value string, buf []byte) []byte {
+	tagged := make([]byte, 0, len(buf)+len(key)+len(value)+6)
+	tagged = append(tagged, '{')
+	tagged = strconv.AppendQuote(tagged, key)
+	tagged = append(tagged, ':')
+	tagged = strconv.AppendQuote(tagged, value)
+	rest := bytes.TrimSpace(buf[1:])
+	if len(rest) > 0 && rest[0] != '}' {
+		tagged = append(tagged, ',')
+	}
+	return append(tagged, rest...)
+}
+
+// appendField adds a field with an already JSON encoded value as last field of a JSON encoded event.
+func appendField(key string, value []byte, buf []byte) []byte {
+	rest := bytes.TrimRight(buf, " \n")
+	rest = rest[:len(rest)-1]
+	tagged := make([]byte, 0, len(rest)+len(key)+len(value)+5)
+	tagged = append(tagged, rest...)
+	if len(bytes.TrimSpace(rest)) > 1 {
+		tagged = append(tagged, ',')
+	}
+	tagged = strconv.AppendQuote(tagged, key)
+	tagged = append(tagged, ':')
+	tagged = append(tagged, value...)
+	return append(tagged, '}')
+}
@@ -18,43 +18,211 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/gopacket/gopacket"
 	"github.com/gopacket/gopacket/layers"
-	"github.com/inspektor-gadget/inspektor-gadget/pkg/environment"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/datasource"
 	igjson "github.com/inspektor-gadget/inspektor-gadget/pkg/datasource/formatters/json"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/environment"
 	gadgetcontext "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-context"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators"
+	ebpftypes "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/ebpf/types"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators/simple"
 	grpcruntime "github.com/inspektor-gadget/inspektor-gadget/pkg/runtime/grpc"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/capture"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/output"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/packet"
 )
 
-const maxResultLen = 64 * 1024 // 64kb
+// DefaultOutputModeAnnotation is set to "none" on datasources that are not shown by default
+const DefaultOutputModeAnnotation = "cli.default-output-mode"
+
+// DataSourceField is the field added to events to tell which datasource they belong to
+const DataSourceField = "datasource"
+
+// PacketLayersSuffix is appended to the name of raw packet fields to get the name of
+// the field holding the decoded layers of the packet
+const PacketLayersSuffix = "_layers"
+
+var log = slog.Default().With("component", "gadgetmanager")
+
+// EventSink receives every event emitted by a gadget as soon as it is produced.
+// The buffer is only valid for the duration of the call and must be copied if retained.
+type EventSink func(buf []byte)
+
+// RunOption configures a foreground gadget run.
+type RunOption func(*runConfig)
+
+type runConfig struct {
+	sink        EventSink
+	aggregation *output.Aggregation
+	dedupe      *output.Dedupe
+	format      output.Format
+	fields      []string
+	dataSources []string
+	hosts       []string
+	capture     *capture.Capture
+	decodeDepth packet.Depth
+	budget      *output.Budget
+	maxEvents   int
+	stopWhen    *output.Filter
+	result      *Result
+}
+
+// Result holds the results of a foreground run in a structured form, see WithResult.
+type Result struct {
+	// Records holds the returned events, deduped records or aggregated groups as JSON
+	// objects with their fields flattened to their full names
+	Records []json.RawMessage
+	// TotalEvents is the number of events received
+	TotalEvents int
+	// OmittedRecords is the number of records left out to fit into the budget
+	OmittedRecords int
+	// Duration is how long the gadget ran
+	Duration time.Duration
+	// StoppedEarly tells why the gadget was stopped before its duration elapsed, if it was
+	StoppedEarly string
+	// Cancelled is set if the run was cancelled by the client
+	Cancelled bool
+	// HostErrors holds the failures of single hosts
+	HostErrors HostErrors
+}
+
+func defaultRunConfig() runConfig {
+	return runConfig{
+		format:      output.FormatJSONL,
+		decodeDepth: packet.DepthApplication,
+	}
+}
+
+// WithSink sets a sink that is invoked for every event while the gadget runs.
+func WithSink(sink EventSink) RunOption {
+	return func(cfg *runConfig) {
+		cfg.sink = sink
+	}
+}
+
+// WithAggregation groups and summarizes the events before returning them.
+func WithAggregation(agg *output.Aggregation) RunOption {
+	return func(cfg *runConfig) {
+		cfg.aggregation = agg
+	}
+}
+
+// WithDedupe merges duplicate events into a single one with their number of occurrences.
+func WithDedupe(dedupe *output.Dedupe) RunOption {
+	return func(cfg *runConfig) {
+		cfg.dedupe = dedupe
+	}
+}
+
+// WithFormat sets the encoding of the returned results, defaults to output.FormatJSONL.
+func WithFormat(format output.Format) RunOption {
+	return func(cfg *runConfig) {
+		cfg.format = format
+	}
+}
+
+// WithFields limits the serialized fields to the given full field names. Names
+// can be prefixed with - to drop a field while keeping all others, selecting a
+// parent field selects all of its sub fields.
+func WithFields(fields []string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.fields = fields
+	}
+}
+
+// WithDataSources only outputs events of the given datasources, including the ones
+// that are hidden by default.
+func WithDataSources(dataSources []string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.dataSources = dataSources
+	}
+}
+
+// WithDecodeDepth sets up to which protocol layer raw packets are decoded, defaults
+// to packet.DepthApplication.
+func WithDecodeDepth(depth packet.Depth) RunOption {
+	return func(cfg *runConfig) {
+		cfg.decodeDepth = depth
+	}
+}
+
+// WithBudget overrides the size the results are shaped to.
+func WithBudget(budget output.Budget) RunOption {
+	return func(cfg *runConfig) {
+		cfg.budget = &budget
+	}
+}
+
+// WithMaxEvents stops the gadget as soon as the given number of events was received.
+func WithMaxEvents(n int) RunOption {
+	return func(cfg *runConfig) {
+		cfg.maxEvents = n
+	}
+}
+
+// WithStopWhen stops the gadget as soon as an event matching the filter was received,
+// the matching event is included in the results.
+func WithStopWhen(filter *output.Filter) RunOption {
+	return func(cfg *runConfig) {
+		cfg.stopWhen = filter
+	}
+}
+
+// WithResult sets a result that is filled with the records and details of the run in
+// addition to the returned text. As both are sent, the text and the records get half
+// of the budget each.
+func WithResult(result *Result) RunOption {
+	return func(cfg *runConfig) {
+		cfg.result = result
+	}
+}
+
+// WithHosts runs the gadget only on the given hosts instead of all of them, see GadgetManager.Hosts.
+func WithHosts(hosts []string) RunOption {
+	return func(cfg *runConfig) {
+		cfg.hosts = hosts
+	}
+}
 
 // GadgetManager is an interface for managing gadgets.
 type GadgetManager interface {
 	// Run starts a gadget with the given image and parameters, returning the output as a string.
-	Run(image string, params map[string]string, timeout time.Duration) (string, error)
-	// RunDetached starts a gadget with the given image and parameters in the background, returning its ID.
-	RunDetached(image string, params map[string]string) (string, error)
-	// GetResults returns the stored result buffer from a gadget
-	GetResults(id string) (string, error)
+	// The gadget is stopped as soon as ctx is cancelled, returning the results collected so far.
+	// Failures of single hosts are reported in the output, an error is only returned if all hosts failed.
+	Run(ctx context.Context, image string, params map[string]string, timeout time.Duration, opts ...RunOption) (string, error)
+	// RunDetached starts a gadget with the given image and parameters in the background on the given
+	// hosts, or all of them if none are given, returning its ID. If it could only be started on some
+	// of the hosts, the ID is returned together with HostErrors.
+	RunDetached(ctx context.Context, image string, params map[string]string, hosts []string) (string, error)
+	// GetResults returns up to limit events collected from a gadget running in the background,
+	// starting at cursor. An empty cursor starts at the oldest stored event.
+	GetResults(ctx context.Context, id string, cursor string, limit int) (*ResultPage, error)
 	// Stop stops a gadget
-	Stop(id string) error
+	Stop(ctx context.Context, id string) error
 	// GetInfo retrieves information about a gadget image via runtime.
 	GetInfo(ctx context.Context, image string) (*api.GadgetInfo, error)
 	// GetVersion retrieves the version of Inspektor Gadget installed in the cluster
 	GetVersion() (string, error)
-	// ListGadgets lists all running gadget instances
+	// ListGadgets lists all running gadget instances. If some of the hosts could not be
+	// reached, the instances of the others are returned together with HostErrors.
 	ListGadgets(ctx context.Context) ([]*GadgetInstance, error)
+	// Hosts returns the addresses of the daemons gadgets are run on if there is more
+	// than one of them, events are then tagged with the HostField.
+	Hosts() []string
+	// ResultBudget returns the default size results are shaped to.
+	ResultBudget() output.Budget
 }
 
 // GadgetInstance represents a running gadget instance
@@ -64,269 +232,732 @@ type GadgetInstance struct {
 	Params      string `json:"params"`
 	CreatedBy   string `json:"createdBy,omitempty"`
 	StartedAt   string `json:"startedAt,omitempty"`
+	Host        string `json:"host,omitempty"`
 }
 
 type gadgetManager struct {
 	k8sConfig       *genericclioptions.ConfigFlags
 	formatterMu     sync.Mutex
 	env             string
-	remoteAddr      string
 	gadgetNamespace string
+	captures        *capture.Store
+	budget          output.Budget
+
+	// hosts holds the remote addresses in linux mode, or a single empty host in kubernetes mode
+	hosts    []string
+	runtimes map[string]*sharedRuntime
+
+	storesMu sync.Mutex
+	stores   map[string]*resultStore
+}
+
+// Option configures a GadgetManager.
+type Option func(*gadgetManager)
+
+// WithCaptureStore writes the raw packets emitted by gadgets to pcapng captures in the given store.
+func WithCaptureStore(captures *capture.Store) Option {
+	return func(g *gadgetManager) {
+		g.captures = captures
+	}
+}
+
+// WithResultBudget sets the default size results are shaped to, defaults to output.DefaultBudget.
+func WithResultBudget(budget output.Budget) Option {
+	return func(g *gadgetManager) {
+		g.budget = budget
+	}
 }
 
 // NewGadgetManager creates a new GadgetManager instance.
-func NewGadgetManager(env string, linuxRemoteAddress string, k8sConfig *genericclioptions.ConfigFlags, gadgetNamespace string) (GadgetManager, error) {
+func NewGadgetManager(env string, linuxRemoteAddress string, k8sConfig *genericclioptions.ConfigFlags, gadgetNamespace string, opts ...Option) (GadgetManager, error) {
 	if env != "kubernetes" && env != "linux" {
 		return nil, fmt.Errorf("unsupported gadget manager environment: %s", env)
 	}
 	if env == "linux" && linuxRemoteAddress == "" {
 		return nil, fmt.Errorf("linuxRemoteAddress must be set when environment is linux")
 	}
-	return &gadgetManager{
+	g := &gadgetManager{
 		k8sConfig:       k8sConfig,
 		env:             env,
-		remoteAddr:      linuxRemoteAddress,
 		gadgetNamespace: gadgetNamespace,
-	}, nil
+		budget:          output.DefaultBudget,
+		hosts:           []string{""},
+		runtimes:        make(map[string]*sharedRuntime),
+		stores:          make(map[string]*resultStore),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	// the environment is global to the runtime package, so it's set once instead of per runtime
+	environment.Environment = environment.Kubernetes
+	if env == "linux" {
+		environment.Environment = environment.Local
+		// each daemon is a target of its own, so that events and failures can be told apart
+		g.hosts = splitHosts(linuxRemoteAddress)
+	}
+	for _, host := range g.hosts {
+		g.runtimes[host] = newSharedRuntime(func() (*grpcruntime.Runtime, error) {
+			return g.newRuntime(host)
+		}, maxConcurrentCalls)
+	}
+	return g, nil
 }
 
-func (g *gadgetManager) Run(image string, params map[string]string, timeout time.Duration) (string, error) {
-	var res strings.Builder
-	gadgetCtx := gadgetcontext.New(
-		context.Background(),
-		image,
-		gadgetcontext.WithDataOperators(
-			g.outputOperator(func(buf []byte) {
-				res.Write(buf)
-				res.WriteByte('\n')
-			}),
-		),
-		gadgetcontext.WithTimeout(timeout),
-	)
+func (g *gadgetManager) ResultBudget() output.Budget {
+	return g.budget
+}
+
+func (g *gadgetManager) Hosts() []string {
+	if len(g.hosts) < 2 {
+		return nil
+	}
+	return g.hosts
+}
 
-	runtime, err := g.getRuntime()
+func (g *gadgetManager) Run(ctx context.Context, image string, params map[string]string, timeout time.Duration, opts ...RunOption) (string, error) {
+	start := time.Now()
+	cfg := defaultRunConfig()
+	cfg.budget = &g.budget
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.result != nil {
+		half := *cfg.budget
+		half.Size = max(1, half.Size/2)
+		cfg.budget = &half
+	}
+	hosts, err := g.selectHosts(cfg.hosts)
 	if err != nil {
-		return "", fmt.Errorf("getting runtime: %w", err)
+		return "", err
+	}
+	tagHost := len(g.hosts) > 1
+	if g.captures != nil {
+		cfg.capture = g.captures.New(captureName(image))
+		// the capture is closed before summarizing it, this only covers failed runs
+		defer func() {
+			if err := cfg.capture.Close(); err != nil {
+				log.Warn("Failed to close capture", "error", err)
+			}
+		}()
+	}
+
+	// make sure the fields needed for the aggregation, the dedupe key or the stop condition are serialized
+	var required []string
+	if cfg.stopWhen != nil {
+		required = append(required, cfg.stopWhen.Fields()...)
+	}
+	var aggregator *output.Aggregator
+	if cfg.aggregation != nil {
+		aggregator = output.NewAggregator(*cfg.aggregation)
+		required = append(required, cfg.aggregation.Fields()...)
+	}
+	var deduper *output.Deduper
+	if cfg.dedupe != nil {
+		deduper = output.NewDeduper(*cfg.dedupe)
+		required = append(required, cfg.dedupe.Fields()...)
+	}
+	cfg.fields = requireFields(cfg.fields, required)
+
+	// mu protects events, aggregator and deduper, since events might still arrive while
+	// the gadget is being torn down
+	var mu sync.Mutex
+	var events []string
+	done := false
+
+	// runCtx is cancelled as soon as a stop condition is met, duration is only an upper bound
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	received := 0
+	var stopReason string
+
+	collect := func(host string) func(buf []byte) {
+		return func(buf []byte) {
+			if tagHost {
+				buf = tagEvent(HostField, host, buf)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if done {
+				return
+			}
+			if cfg.sink != nil {
+				cfg.sink(buf)
+			}
+
+			var rec *output.Record
+			if aggregator != nil || deduper != nil || cfg.stopWhen != nil {
+				var err error
+				rec, err = output.ParseRecord(buf)
+				if err != nil {
+					log.Warn("Skipping event", "error", err)
+					return
+				}
+			}
+			switch {
+			case aggregator != nil:
+				aggregator.Add(rec)
+			case deduper != nil:
+				deduper.Add(rec)
+			default:
+				events = append(events, string(buf))
+			}
+
+			received++
+			if cfg.maxEvents > 0 && received >= cfg.maxEvents {
+				stopReason = fmt.Sprintf("received max_events (%d)", cfg.maxEvents)
+			} else if cfg.stopWhen != nil && cfg.stopWhen.Match(rec) {
+				stopReason = "received an event matching stop_when"
+			}
+			if stopReason != "" {
+				done = true
+				stop()
+			}
+		}
+	}
+
+	errs := g.forEachHost(runCtx, hosts, func(ctx context.Context, host string, shared *sharedRuntime) error {
+		gadgetCtx := gadgetcontext.New(
+			ctx,
+			image,
+			gadgetcontext.WithDataOperators(g.outputOperator(cfg, host, collect(host))),
+			gadgetcontext.WithTimeout(timeout),
+		)
+
+		runtime, release, err := shared.acquire(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = runtime.RunGadget(gadgetCtx, runtime.ParamDescs().ToParams(), params)
+		release(err)
+		// a cancelled request is not an error, return what was collected until then
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("running gadget: %w", err)
+		}
+		return nil
+	})
+	if len(errs) == len(hosts) {
+		return "", errs
 	}
 
-	if err = runtime.RunGadget(gadgetCtx, runtime.ParamDescs().ToParams(), params); err != nil {
-		return "", fmt.Errorf("running gadget: %w", err)
+	mu.Lock()
+	done = true
+	mu.Unlock()
+
+	res, err := formatResults(cfg, aggregator, deduper, events)
+	if err != nil {
+		return "", err
+	}
+	if cfg.result != nil {
+		if err := fillResult(cfg, aggregator, deduper, events); err != nil {
+			return "", err
+		}
+		cfg.result.TotalEvents = received
+		cfg.result.Duration = time.Since(start)
+		cfg.result.StoppedEarly = stopReason
+		cfg.result.Cancelled = ctx.Err() != nil
+		cfg.result.HostErrors = errs
+	}
+	if ctx.Err() != nil {
+		res = "\n<cancelled>true</cancelled>" + res
+	} else if stopReason != "" {
+		res = fmt.Sprintf("\n<stoppedEarly>%s</stoppedEarly>", stopReason) + res
 	}
-	return truncateResults(res.String(), false), nil
+	if cfg.capture != nil {
+		if err := cfg.capture.Close(); err != nil {
+			log.Warn("Failed to close capture", "error", err)
+		}
+		res = cfg.capture.Summary() + res
+	}
+	return errs.String() + res, nil
 }
 
-func (g *gadgetManager) RunDetached(image string, params map[string]string) (string, error) {
-	gadgetCtx := gadgetcontext.New(
-		context.Background(),
-		image,
-	)
-	runtime, err := g.getRuntime()
+// formatResults encodes the collected events, the aggregated rows or the deduped
+// records in the requested format.
+func formatResults(cfg runConfig, aggregator *output.Aggregator, deduper *output.Deduper, events []string) (string, error) {
+	if aggregator != nil {
+		return aggregatedResults(aggregator, cfg.format, *cfg.budget)
+	}
+	if deduper != nil {
+		return dedupedResults(deduper, cfg.format, *cfg.budget)
+	}
+	if cfg.format == output.FormatJSONL {
+		return ShapeResults("", events, *cfg.budget, true), nil
+	}
+
+	records := make([]*output.Record, 0, len(events))
+	for _, ev := range events {
+		rec, err := output.ParseRecord([]byte(ev))
+		if err != nil {
+			log.Warn("Skipping event for encoding", "error", err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	header, rows, err := output.Encode(cfg.format, records)
 	if err != nil {
-		return "", fmt.Errorf("getting runtime: %w", err)
+		return "", fmt.Errorf("encoding results: %w", err)
 	}
+	return ShapeResults(header, rows, *cfg.budget, true), nil
+}
 
-	p := runtime.ParamDescs().ToParams()
+// fillResult sets the records of cfg.result to the collected events, the aggregated
+// rows or the deduped records, shaped like by formatResults.
+func fillResult(cfg runConfig, aggregator *output.Aggregator, deduper *output.Deduper, events []string) error {
+	var records []*output.Record
+	switch {
+	case aggregator != nil:
+		records = aggregator.Rows()
+	case deduper != nil:
+		records = deduper.Records()
+	default:
+		records = make([]*output.Record, 0, len(events))
+		for _, ev := range events {
+			rec, err := output.ParseRecord([]byte(ev))
+			if err != nil {
+				log.Warn("Skipping event for the result", "error", err)
+				continue
+			}
+			records = append(records, rec)
+		}
+	}
+	_, rows, err := output.Encode(output.FormatJSONL, records)
+	if err != nil {
+		return fmt.Errorf("encoding result records: %w", err)
+	}
+	// aggregated rows are sorted by relevance, so keep the first ones instead of sampling
+	shaped := output.Shape("", rows, *cfg.budget, aggregator == nil)
+	cfg.result.Records = make([]json.RawMessage, 0, len(shaped.Rows))
+	cfg.result.OmittedRecords = shaped.Omitted
+	// a truncated record is no valid JSON anymore
+	if shaped.Truncated {
+		cfg.result.OmittedRecords = len(rows)
+		return nil
+	}
+	for _, row := range shaped.Rows {
+		cfg.result.Records = append(cfg.result.Records, json.RawMessage(row))
+	}
+	return nil
+}
 
+func (g *gadgetManager) RunDetached(ctx context.Context, image string, params map[string]string, hosts []string) (string, error) {
+	hosts, err := g.selectHosts(hosts)
+	if err != nil {
+		return "", err
+	}
 	newID := make([]byte, 16)
 	rand.Read(newID)
 	idString := hex.EncodeToString(newID)
 
-	p.Set(grpcruntime.ParamTags, "createdBy=ig-mcp-server")
-	p.Set(grpcruntime.ParamID, idString)
-	p.Set(grpcruntime.ParamDetach, "true")
-	if err = runtime.RunGadget(gadgetCtx, p, params); err != nil {
-		return "", fmt.Errorf("running gadget: %w", err)
+	// the instance gets the same ID on all hosts, so it can be handled as a single one
+	errs := g.forEachHost(ctx, hosts, func(ctx context.Context, host string, shared *sharedRuntime) error {
+		gadgetCtx := gadgetcontext.New(
+			ctx,
+			image,
+		)
+		runtime, release, err := shared.acquire(ctx)
+		if err != nil {
+			return err
+		}
+
+		p := runtime.ParamDescs().ToParams()
+		p.Set(grpcruntime.ParamTags, "createdBy=ig-mcp-server")
+		p.Set(grpcruntime.ParamID, idString)
+		p.Set(grpcruntime.ParamDetach, "true")
+		err = runtime.RunGadget(gadgetCtx, p, params)
+		release(err)
+		if err != nil {
+			return fmt.Errorf("running gadget: %w", err)
+		}
+		return nil
+	})
+	if len(errs) == len(hosts) {
+		return "", errs
+	}
+
+	var started []string
+	for _, host := range hosts {
+		if _, ok := errs[host]; !ok {
+			started = append(started, host)
+		}
+	}
+	// start collecting results right away so that no events are missed
+	g.collect(idString, started)
+
+	if len(errs) > 0 {
+		return idString, errs
 	}
 	return idString, nil
 }
 
-func (g *gadgetManager) Stop(id string) error {
-	runtime, err := g.getRuntime()
-	if err != nil {
-		return fmt.Errorf("getting runtime: %w", err)
+func (g *gadgetManager) Stop(ctx context.Context, id string) error {
+	hosts := g.hosts
+	g.storesMu.Lock()
+	s, ok := g.stores[id]
+	g.storesMu.Unlock()
+	if ok {
+		hosts = s.hosts
+	}
+
+	errs := g.forEachHost(ctx, hosts, func(ctx context.Context, host string, shared *sharedRuntime) error {
+		runtime, release, err := shared.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		err = runtime.RemoveGadgetInstance(ctx, runtime.ParamDescs().ToParams(), id)
+		release(err)
+		if err != nil {
+			return fmt.Errorf("stopping to gadget: %w", err)
+		}
+		return nil
+	})
+	if len(errs) == len(hosts) {
+		return errs
 	}
-	if err = runtime.RemoveGadgetInstance(context.Background(), runtime.ParamDescs().ToParams(), id); err != nil {
-		return fmt.Errorf("stopping to gadget: %w", err)
+
+	g.storesMu.Lock()
+	if s, ok := g.stores[id]; ok {
+		s.close()
+		delete(g.stores, id)
+	}
+	g.storesMu.Unlock()
+	if len(errs) > 0 {
+		return errs
 	}
 	return nil
 }
 
-func (g *gadgetManager) GetResults(id string) (string, error) {
-	var res strings.Builder
-	to, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+func (g *gadgetManager) GetResults(ctx context.Context, id string, cursor string, limit int) (*ResultPage, error) {
+	s := g.collect(id, g.hosts)
 
-	gadgetCtx := gadgetcontext.New(
-		to,
-		id,
-		gadgetcontext.WithDataOperators(
-			g.outputOperator(func(buf []byte) {
-				res.Write(buf)
-				res.WriteByte('\n')
-			}),
-		),
-		gadgetcontext.WithID(id),
-		gadgetcontext.WithUseInstance(true),
-		gadgetcontext.WithTimeout(time.Second),
-	)
+	// give a freshly attached collector some time to receive the events buffered by the instance
+	select {
+	case <-s.ready:
+	case <-time.After(time.Second):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
-	runtime, err := g.getRuntime()
-	if err != nil {
-		return "", fmt.Errorf("getting runtime: %w", err)
+	if errs := s.failed(); errs != nil && s.empty() {
+		g.dropStore(id, s)
+		return nil, fmt.Errorf("attaching to gadget: %w", errs)
 	}
 
-	if err = runtime.RunGadget(gadgetCtx, runtime.ParamDescs().ToParams(), map[string]string{}); err != nil {
-		return "", fmt.Errorf("attaching to gadget: %w", err)
+	page, err := s.page(cursor, limit, g.budget.Bytes())
+	if err != nil {
+		return nil, err
 	}
-	return truncateResults(res.String(), true), nil
+	// nothing is left to read once the instance is gone and all its events were returned
+	if page.Completed {
+		g.dropStore(id, s)
+	}
+	return page, nil
 }
 
-func (g *gadgetManager) GetInfo(ctx context.Context, image string) (*api.GadgetInfo, error) {
-	gadgetCtx := gadgetcontext.New(
-		ctx,
-		image,
-	)
-
-	runtime, err := g.getRuntime()
-	if err != nil {
-		return nil, fmt.Errorf("getting runtime: %w", err)
+// dropStore removes the result store s of the given instance, unless it was replaced already.
+func (g *gadgetManager) dropStore(id string, s *resultStore) {
+	g.storesMu.Lock()
+	defer g.storesMu.Unlock()
+	if g.stores[id] == s {
+		s.close()
+		delete(g.stores, id)
 	}
+}
 
-	info, err := runtime.GetGadgetInfo(gadgetCtx, runtime.ParamDescs().ToParams(), nil)
-	if err != nil {
-		return nil, fmt.Errorf("get gadget info: %w", err)
+// evictStores removes the result stores of instances that finished more than
+// storeTTL before now without being read completely. storesMu must be held.
+func (g *gadgetManager) evictStores(now time.Time) {
+	for id, s := range g.stores {
+		if s.expired(now, storeTTL) {
+			s.close()
+			delete(g.stores, id)
+		}
 	}
-	return info, nil
 }
 
-func (g *gadgetManager) ListGadgets(ctx context.Context) ([]*GadgetInstance, error) {
-	rt, err := g.getRuntime()
-	if err != nil {
-		return nil, fmt.Errorf("getting runtime: %w", err)
+// collect returns the result store of the given instance, attaching to the instance
+// on the given hosts in the background if no store exists yet.
+func (g *gadgetManager) collect(id string, hosts []string) *resultStore {
+	g.storesMu.Lock()
+	defer g.storesMu.Unlock()
+
+	g.evictStores(time.Now())
+	if s, ok := g.stores[id]; ok {
+		return s
 	}
 
-	instances, err := rt.GetGadgetInstances(ctx, rt.ParamDescs().ToParams())
-	if err != nil {
-		return nil, fmt.Errorf("listing gadgets: %w", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newResultStore(maxStoredEvents, hosts, cancel)
+	if g.captures != nil {
+		s.capture = g.captures.New(id)
 	}
+	g.stores[id] = s
 
-	var gadgetInstances []*GadgetInstance
-	for _, instance := range instances {
-		inst := gadgetInstanceFromAPI(instance)
-		if inst != nil {
-			gadgetInstances = append(gadgetInstances, inst)
-		}
+	tagHost := len(g.hosts) > 1
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cb := s.append
+			if tagHost {
+				cb = func(buf []byte) { s.append(tagEvent(HostField, host, buf)) }
+			}
+			s.finish(host, g.attach(ctx, g.runtimes[host], id, host, s.capture, cb))
+		}()
 	}
-	return gadgetInstances, nil
+	go func() {
+		wg.Wait()
+		cancel()
+		if s.capture != nil {
+			if err := s.capture.Close(); err != nil {
+				log.Warn("Failed to close capture", "error", err)
+			}
+		}
+	}()
+	return s
 }
 
-func (g *gadgetManager) GetVersion() (string, error) {
-	rt, err := g.getRuntime()
+func collectorRunConfig(c *capture.Capture) runConfig {
+	cfg := defaultRunConfig()
+	cfg.capture = c
+	return cfg
+}
+
+// attach streams the events of a running instance to cb until the instance is
+// removed or ctx is cancelled.
+func (g *gadgetManager) attach(ctx context.Context, shared *sharedRuntime, id string, host string, c *capture.Capture, cb func(buf []byte)) error {
+	gadgetCtx := gadgetcontext.New(
+		ctx,
+		id,
+		gadgetcontext.WithDataOperators(g.outputOperator(collectorRunConfig(c), host, cb)),
+		gadgetcontext.WithID(id),
+		gadgetcontext.WithUseInstance(true),
+	)
+
+	// collectors run for as long as the instance exists, so they don't take part in the concurrency limit
+	runtime, err := shared.get(ctx)
 	if err != nil {
-		return "", fmt.Errorf("getting runtime: %w", err)
+		return err
 	}
 
-	info, err := rt.GetInfo()
-	if err != nil {
-		return "", fmt.Errorf("getting info: %w", err)
+	if err = runtime.RunGadget(gadgetCtx, runtime.ParamDescs().ToParams(), map[string]string{}); err != nil && ctx.Err() == nil {
+		shared.markUnhealthy(runtime)
+		return err
 	}
-	return info.ServerVersion, nil
+	return nil
 }
 
-func truncateResults(results string, latest bool) string {
-	if len(results) <= maxResultLen {
-		return fmt.Sprintf("\n<results>%s</results>\n", results)
-	}
+func (g *gadgetManager) GetInfo(ctx context.Context, image string) (*api.GadgetInfo, error) {
+	// all hosts are expected to serve the same gadgets, use the first one that answers
+	errs := HostErrors{}
+	for _, host := range g.hosts {
+		gadgetCtx := gadgetcontext.New(
+			ctx,
+			image,
+		)
 
-	var truncated string
-	if latest {
-		truncated = results[len(results)-maxResultLen:]
-	} else {
-		truncated = results[:maxResultLen] + "…"
-	}
+		runtime, release, err := g.runtimes[host].acquire(ctx)
+		if err != nil {
+			errs[host] = err
+			continue
+		}
 
-	return fmt.Sprintf("\n<isTruncated>true</isTruncated>\n<results>%s</results>\n", truncated)
+		info, err := runtime.GetGadgetInfo(gadgetCtx, runtime.ParamDescs().ToParams(), nil)
+		release(err)
+		if err != nil {
+			errs[host] = fmt.Errorf("get gadget info: %w", err)
+			continue
+		}
+		return info, nil
+	}
+	return nil, errs
 }
 
-func (g *gadgetManager) getRuntime() (*grpcruntime.Runtime, error) {
-	if g.env == "kubernetes" {
-		environment.Environment = environment.Kubernetes
-		rt := grpcruntime.New(grpcruntime.WithConnectUsingK8SProxy)
-		gp := rt.GlobalParamDescs().ToParams()
-		if g.gadgetNamespace != "" {
-			if err := gp.Set(grpcruntime.ParamGadgetNamespace, g.gadgetNamespace); err != nil {
-				return nil, fmt.Errorf("setting gadget namespace: %w", err)
-			}
-		}
-		if err := rt.Init(gp); err != nil {
-			return nil, fmt.Errorf("initializing gadget runtime: %w", err)
+func (g *gadgetManager) ListGadgets(ctx context.Context) ([]*GadgetInstance, error) {
+	var mu sync.Mutex
+	var gadgetInstances []*GadgetInstance
+	errs := g.forEachHost(ctx, g.hosts, func(ctx context.Context, host string, shared *sharedRuntime) error {
+		rt, release, err := shared.acquire(ctx)
+		if err != nil {
+			return err
 		}
 
-		restConfig, err := g.k8sConfig.ToRESTConfig()
+		instances, err := rt.GetGadgetInstances(ctx, rt.ParamDescs().ToParams())
+		release(err)
 		if err != nil {
-			return nil, fmt.Errorf("creating REST config: %w", err)
+			return fmt.Errorf("listing gadgets: %w", err)
 		}
-		rt.SetRestConfig(restConfig)
 
-		return rt, nil
+		mu.Lock()
+		defer mu.Unlock()
+		for _, instance := range instances {
+			inst := gadgetInstanceFromAPI(instance)
+			if inst != nil {
+				inst.Host = host
+				gadgetInstances = append(gadgetInstances, inst)
+			}
+		}
+		return nil
+	})
+	if len(errs) == len(g.hosts) {
+		return nil, errs
 	}
-	if g.env == "linux" {
-		environment.Environment = environment.Local
-		rt := grpcruntime.New()
-		gp := rt.GlobalParamDescs().ToParams()
-		err := gp.Set(grpcruntime.ParamRemoteAddress, g.remoteAddr)
+	// keep the order stable across calls
+	slices.SortStableFunc(gadgetInstances, func(a, b *GadgetInstance) int {
+		return strings.Compare(a.Host, b.Host)
+	})
+	if len(errs) > 0 {
+		return gadgetInstances, errs
+	}
+	return gadgetInstances, nil
+}
+
+func (g *gadgetManager) GetVersion() (string, error) {
+	errs := HostErrors{}
+	for _, host := range g.hosts {
+		rt, release, err := g.runtimes[host].acquire(context.Background())
 		if err != nil {
-			return nil, fmt.Errorf("setting remote address: %w", err)
+			errs[host] = err
+			continue
 		}
-		if err = rt.Init(gp); err != nil {
-			return nil, fmt.Errorf("initializing gadget runtime: %w", err)
+
+		// the version is cached by the runtime, so this is cheap after the first call
+		info, err := rt.GetInfo()
+		release(err)
+		if err != nil {
+			errs[host] = fmt.Errorf("getting info: %w", err)
+			continue
 		}
-		return rt, nil
+		return info.ServerVersion, nil
 	}
-	return nil, fmt.Errorf("unsupported gadget manager environment: %s", g.env)
+	return "", errs
 }
 
-func (g *gadgetManager) outputOperator(cb func(buf []byte)) operators.DataOperator {
+// ShapeResults joins the header and the rows that fit into the budget, see output.Shape.
+func ShapeResults(header string, rows []string, budget output.Budget, sample bool) string {
+	shaped := output.Shape(header, rows, budget, sample)
+	var res strings.Builder
+	if shaped.Omitted > 0 || shaped.Truncated {
+		res.WriteString("\n<isTruncated>true</isTruncated>")
+		fmt.Fprintf(&res, "\n<omittedRecords>%d</omittedRecords>", shaped.Omitted)
+		fmt.Fprintf(&res, "\n<omissionReason>%s</omissionReason>", shaped.Reason)
+		fmt.Fprintf(&res, "\n<sampling>%s</sampling>", shaped.Sampling)
+	}
+	res.WriteString("\n<results>")
+	if header != "" {
+		res.WriteString(header)
+		res.WriteByte('\n')
+	}
+	for _, row := range shaped.Rows {
+		res.WriteString(row)
+		res.WriteByte('\n')
+	}
+	res.WriteString("</results>\n")
+	return res.String()
+}
+
+func aggregatedResults(aggregator *output.Aggregator, format output.Format, budget output.Budget) (string, error) {
+	header, rows, err := output.Encode(format, aggregator.Rows())
+	if err != nil {
+		return "", fmt.Errorf("encoding aggregated rows: %w", err)
+	}
+	summary := fmt.Sprintf("\n<totalEvents>%d</totalEvents>\n<totalGroups>%d</totalGroups>", aggregator.Events(), aggregator.Groups())
+	// rows are sorted by relevance, so keep the first ones instead of sampling
+	return summary + ShapeResults(header, rows, budget, false), nil
+}
+
+func dedupedResults(deduper *output.Deduper, format output.Format, budget output.Budget) (string, error) {
+	records := deduper.Records()
+	header, rows, err := output.Encode(format, records)
+	if err != nil {
+		return "", fmt.Errorf("encoding deduped records: %w", err)
+	}
+	summary := fmt.Sprintf("\n<totalEvents>%d</totalEvents>\n<uniqueRecords>%d</uniqueRecords>", deduper.Events(), len(records))
+	return summary + ShapeResults(header, rows, budget, true), nil
+}
+
+// outputOperator serializes the events of the selected datasources and passes them to cb.
+// Raw packets are also written to cfg.capture, using host and the datasource name as interface.
+func (g *gadgetManager) outputOperator(cfg runConfig, host string, cb func(buf []byte)) operators.DataOperator {
 	const opPriority = 50000
 	return simple.New("outputOperator",
 		simple.OnInit(func(gadgetCtx operators.GadgetContext) error {
+			var dataSources []datasource.DataSource
 			for _, d := range gadgetCtx.GetDataSources() {
+				if cfg.dataSources != nil {
+					if slices.Contains(cfg.dataSources, d.Name()) {
+						dataSources = append(dataSources, d)
+					}
+					continue
+				}
 				// skip data sources that have the annotation "cli.default-output-mode"
-				if m, ok := d.Annotations()["cli.default-output-mode"]; ok && m == "none" {
+				if m, ok := d.Annotations()[DefaultOutputModeAnnotation]; ok && m == "none" {
 					continue
 				}
+				dataSources = append(dataSources, d)
+			}
+			// tag events with their datasource if they could be mixed up
+			tag := len(dataSources) > 1
 
-				// handle adding a raw string field for certain content types
+			for _, d := range dataSources {
+
+				// handle decoding fields holding raw packets
 				restField := d.Annotations()["ebpf.rest.name"]
-				var restAcc datasource.FieldAccessor
-				var restStrAcc datasource.FieldAccessor
-				var err error
+				var pktAcc datasource.FieldAccessor
+				var tsAcc datasource.FieldAccessor
+				linkType := layers.LinkTypeEthernet
+				layersField := restField + PacketLayersSuffix
 				if restField != "" {
-					restAcc = d.GetField(restField)
-					ct, ok := restAcc.Annotations()["content-type"]
-					if ok && ct == "application/x-raw-packet" {
-						restStrAcc, err = d.AddField(restField+"_string", api.Kind_String)
+					restAcc := d.GetField(restField)
+					if restAcc != nil && restAcc.Annotations()["content-type"] == "application/x-raw-packet" {
+						pktAcc = restAcc
+						lt, err := packet.ParseLinkType(restAcc.Annotations()[packet.LinkTypeAnnotation])
 						if err != nil {
-							return fmt.Errorf("adding raw string field accessor: %w", err)
+							log.Warn("Falling back to ethernet link type", "field", restField, "error", err)
+						} else {
+							linkType = lt
+						}
+						// the timestamp was already converted to wall time by the formatters operator of the daemon
+						if ts := d.GetFieldsWithTag("type:" + ebpftypes.TimestampTypeName); len(ts) > 0 {
+							tsAcc = ts[0]
 						}
 					}
 				}
+				decodeLayers := pktAcc != nil && cfg.decodeDepth != packet.DepthNone && isSelected(layersField, cfg.fields)
+				iface := d.Name()
+				if host != "" {
+					iface = host + "/" + iface
+				}
 
-				jsonFormatter, _ := igjson.New(d,
-					igjson.WithShowAll(true),
-				)
+				formatterOpts := []igjson.Option{igjson.WithShowAll(true)}
+				if cfg.fields != nil {
+					formatterOpts = []igjson.Option{igjson.WithFields(expandFields(d, cfg.fields))}
+				}
+				jsonFormatter, err := igjson.New(d, formatterOpts...)
+				if err != nil {
+					return fmt.Errorf("creating json formatter: %w", err)
+				}
 
 				d.Subscribe(func(source datasource.DataSource, data datasource.Data) error {
 					g.formatterMu.Lock()
 					defer g.formatterMu.Unlock()
-					if restAcc != nil && restStrAcc != nil {
-						pktStr := gopacket.NewPacket(restAcc.Get(data), layers.LinkTypeEthernet, gopacket.Default).String()
-						err = restStrAcc.Set(data, []byte(pktStr))
-						if err != nil {
-							return fmt.Errorf("setting raw string field: %w", err)
-						}
+					if pktAcc != nil && cfg.capture != nil {
+						cfg.capture.WritePacket(iface, linkType, packetTime(tsAcc, data), pktAcc.Get(data))
 					}
 					jsonData := jsonFormatter.Marshal(data)
+					if tag {
+						jsonData = tagEvent(DataSourceField, source.Name(), jsonData)
+					}
+					if decodeLayers {
+						if decoded := packet.Decode(pktAcc.Get(data), linkType, cfg.decodeDepth); len(decoded) > 0 {
+							raw, err := json.Marshal(decoded)
+							if err != nil {
+								return fmt.Errorf("encoding packet layers: %w", err)
+							}
+							jsonData = appendField(layersField, raw, jsonData)
+						}
+					}
 					cb(jsonData)
 					return nil
 				}, opPriority)
@@ -336,6 +967,91 @@ func (g *gadgetManager) outputOperator(cb func(buf []byte)) operators.DataOperat
 	)
 }
 
+// packetTime returns the time a packet was captured at, falling back to the
+// current time if the datasource has no timestamp.
+func packetTime(tsAcc datasource.FieldAccessor, data datasource.Data) time.Time {
+	if tsAcc == nil {
+		return time.Now()
+	}
+	ts, err := tsAcc.Uint64(data)
+	if err != nil || ts == 0 {
+		return time.Now()
+	}
+	return time.Unix(0, int64(ts))
+}
+
+// captureName returns a unique capture file name for a run of the given image.
+func captureName(image string) string {
+	name := image
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	name, _, _ = strings.Cut(name, ":")
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s-%s", name, time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(suffix))
+}
+
+// expandFields turns the requested fields into the explicit list of fields of
+// the datasource to serialize: parent fields are replaced by all of their sub
+// fields and fields prefixed with - are removed from the selection (or from all
+// fields if nothing else is selected).
+func expandFields(d datasource.DataSource, fields []string) []string {
+	var expanded []string
+	for _, field := range d.Fields() {
+		if isSelected(field.FullName, fields) {
+			expanded = append(expanded, field.FullName)
+		}
+	}
+	return expanded
+}
+
+// requireFields returns the selection made using WithFields changed so that the
+// required fields are serialized: they are added to the selected fields and
+// exclusions covering them are removed.
+func requireFields(fields []string, required []string) []string {
+	if fields == nil || len(required) == 0 {
+		return fields
+	}
+	hasSelection := slices.ContainsFunc(fields, func(f string) bool { return !strings.HasPrefix(f, "-") })
+	fields = slices.DeleteFunc(slices.Clone(fields), func(f string) bool {
+		n, ok := strings.CutPrefix(f, "-")
+		return ok && slices.ContainsFunc(required, func(r string) bool {
+			return r == n || strings.HasPrefix(r, n+".")
+		})
+	})
+	if hasSelection {
+		fields = append(fields, required...)
+	}
+	return fields
+}
+
+// isSelected returns true if the field with the given full name is part of the
+// selection made using WithFields.
+func isSelected(name string, fields []string) bool {
+	var include, exclude []string
+	for _, f := range fields {
+		if n, ok := strings.CutPrefix(f, "-"); ok {
+			exclude = append(exclude, n)
+			continue
+		}
+		include = append(include, strings.TrimPrefix(f, "+"))
+	}
+
+	matches := func(selection []string) bool {
+		for _, s := range selection {
+			if name == s || strings.HasPrefix(name, s+".") {
+				return true
+			}
+		}
+		return false
+	}
+	if len(include) > 0 && !matches(include) {
+		return false
+	}
+	return !matches(exclude)
+}
+
 func gadgetInstanceFromAPI(instance *api.GadgetInstance) *GadgetInstance {
 	if instance == nil {
 		return nil
@@ -0,0 +1,450 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gadgetmanager_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgettest"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/output"
+)
+
+func traceExec(comms ...string) *gadgettest.Gadget {
+	g := &gadgettest.Gadget{
+		Image:    "trace_exec",
+		Metadata: "name: trace_exec\n",
+		DataSources: []gadgettest.DataSource{{
+			Name: "exec",
+			Fields: []gadgettest.Field{
+				{Name: "proc.comm", Kind: api.Kind_String},
+				{Name: "proc.pid", Kind: api.Kind_Uint32},
+				{Name: "error", Kind: api.Kind_Int32},
+			},
+		}},
+	}
+	for i, comm := range comms {
+		g.Events = append(g.Events, gadgettest.Event{
+			Values: map[string]any{"proc.comm": comm, "proc.pid": i + 1},
+		})
+	}
+	return g
+}
+
+func newService(t *testing.T, gadgets ...*gadgettest.Gadget) *gadgettest.Service {
+	t.Helper()
+	svc, err := gadgettest.NewService(t.TempDir(), "0.50.1", gadgets...)
+	if err != nil {
+		t.Fatalf("starting service: %v", err)
+	}
+	t.Cleanup(svc.Close)
+	return svc
+}
+
+func newManager(t *testing.T, addresses ...string) gadgetmanager.GadgetManager {
+	t.Helper()
+	mgr, err := gadgetmanager.NewGadgetManager("linux", strings.Join(addresses, ","), nil, "")
+	if err != nil {
+		t.Fatalf("creating gadget manager: %v", err)
+	}
+	return mgr
+}
+
+func TestRun(t *testing.T) {
+	svc := newService(t, traceExec("curl", "sh"))
+	mgr := newManager(t, svc.Address())
+
+	out, err := mgr.Run(context.Background(), "trace_exec", map[string]string{"operator.filter.filter": "error==0"}, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("running gadget: %v", err)
+	}
+	want := "\n<results>" +
+		`{"error":0,"proc":{"comm":"curl","pid":1}}` + "\n" +
+		`{"error":0,"proc":{"comm":"sh","pid":2}}` + "\n" +
+		"</results>\n"
+	if out != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", out, want)
+	}
+
+	runs := svc.Runs()
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	if got := runs[0].ParamValues["operator.filter.filter"]; got != "error==0" {
+		t.Errorf("expected params to be passed to the service, got filter %q", got)
+	}
+}
+
+func TestRunUnknownGadget(t *testing.T) {
+	svc := newService(t, traceExec())
+	mgr := newManager(t, svc.Address())
+
+	if _, err := mgr.Run(context.Background(), "trace_open", nil, 200*time.Millisecond); err == nil {
+		t.Fatal("expected running an unknown gadget to fail")
+	}
+}
+
+func TestRunOptions(t *testing.T) {
+	svc := newService(t, traceExec("curl", "sh", "curl"))
+	mgr := newManager(t, svc.Address())
+
+	tests := []struct {
+		name string
+		opts []gadgetmanager.RunOption
+		want []string
+	}{
+		{
+			name: "csv",
+			opts: []gadgetmanager.RunOption{
+				gadgetmanager.WithFormat(output.FormatCSV),
+				gadgetmanager.WithFields([]string{"proc.comm"}),
+			},
+			want: []string{"<results>proc.comm\ncurl\nsh\ncurl\n</results>"},
+		},
+		{
+			name: "aggregation",
+			opts: []gadgetmanager.RunOption{
+				gadgetmanager.WithAggregation(&output.Aggregation{GroupBy: []string{"proc.comm"}}),
+			},
+			want: []string{
+				"<totalEvents>3</totalEvents>",
+				"<totalGroups>2</totalGroups>",
+				`{"proc.comm":"curl","count":2}`,
+			},
+		},
+		{
+			name: "dedupe",
+			opts: []gadgetmanager.RunOption{
+				gadgetmanager.WithDedupe(&output.Dedupe{Key: []string{"proc.comm"}}),
+			},
+			want: []string{`"count":2`},
+		},
+		{
+			name: "aggregation with excluded group",
+			opts: []gadgetmanager.RunOption{
+				gadgetmanager.WithFields([]string{"-proc"}),
+				gadgetmanager.WithAggregation(&output.Aggregation{GroupBy: []string{"proc.comm"}}),
+			},
+			want: []string{`{"proc.comm":"curl","count":2}`, `{"proc.comm":"sh","count":1}`},
+		},
+		{
+			name: "dedupe with excluded key",
+			opts: []gadgetmanager.RunOption{
+				gadgetmanager.WithFields([]string{"-proc.comm"}),
+				gadgetmanager.WithDedupe(&output.Dedupe{Key: []string{"proc.comm"}}),
+			},
+			want: []string{`{"proc.comm":"curl","count":2,`},
+		},
+		{
+			name: "budget",
+			opts: []gadgetmanager.RunOption{
+				gadgetmanager.WithBudget(output.Budget{Size: 100}),
+			},
+			want: []string{
+				"<isTruncated>true</isTruncated>",
+				"<omittedRecords>1</omittedRecords>",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := mgr.Run(context.Background(), "trace_exec", nil, 200*time.Millisecond, tc.opts...)
+			if err != nil {
+				t.Fatalf("running gadget: %v", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRunStopsEarly(t *testing.T) {
+	g := traceExec("curl", "sh", "bash", "ls")
+	g.Interval = 20 * time.Millisecond
+	svc := newService(t, g)
+	mgr := newManager(t, svc.Address())
+
+	stopWhen, err := output.ParseFilter("proc.comm==bash")
+	if err != nil {
+		t.Fatalf("parsing filter: %v", err)
+	}
+	tests := []struct {
+		name   string
+		opt    gadgetmanager.RunOption
+		reason string
+		events int
+	}{
+		{name: "max_events", opt: gadgetmanager.WithMaxEvents(2), reason: "received max_events (2)", events: 2},
+		{name: "stop_when", opt: gadgetmanager.WithStopWhen(stopWhen), events: 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			out, err := mgr.Run(context.Background(), "trace_exec", nil, time.Minute, tc.opt)
+			if err != nil {
+				t.Fatalf("running gadget: %v", err)
+			}
+			if time.Since(start) > 10*time.Second {
+				t.Errorf("expected the gadget to stop early, it took %s", time.Since(start))
+			}
+			if !strings.Contains(out, "<stoppedEarly>"+tc.reason) {
+				t.Errorf("expected output to tell it stopped early, got:\n%s", out)
+			}
+			if n := strings.Count(out, `"proc":`); n != tc.events {
+				t.Errorf("expected %d events, got %d:\n%s", tc.events, n, out)
+			}
+		})
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	g := traceExec("curl", "sh", "bash")
+	g.Interval = 20 * time.Millisecond
+	svc := newService(t, g)
+	mgr := newManager(t, svc.Address())
+
+	// the fake gadget keeps running after its events, until the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := 0
+	sink := gadgetmanager.WithSink(func(buf []byte) {
+		if received++; received == len(g.Events) {
+			cancel()
+		}
+	})
+
+	start := time.Now()
+	out, err := mgr.Run(ctx, "trace_exec", nil, time.Minute, sink)
+	if err != nil {
+		t.Fatalf("running gadget: %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("expected the gadget to stop once the context was cancelled, it took %s", time.Since(start))
+	}
+	for _, comm := range []string{"curl", "sh", "bash"} {
+		if !strings.Contains(out, `"comm":"`+comm+`"`) {
+			t.Errorf("expected the events collected so far, got:\n%s", out)
+		}
+	}
+}
+
+func TestRunHosts(t *testing.T) {
+	svc1 := newService(t, traceExec("curl"))
+	failing := traceExec()
+	failing.Err = errors.New("gadget not available")
+	svc2 := newService(t, failing)
+	mgr := newManager(t, svc1.Address(), svc2.Address())
+
+	if hosts := mgr.Hosts(); len(hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %v", hosts)
+	}
+
+	out, err := mgr.Run(context.Background(), "trace_exec", nil, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("running gadget: %v", err)
+	}
+	if !strings.Contains(out, `{"host":"`+svc1.Address()+`"`) {
+		t.Errorf("expected events to be tagged with their host, got:\n%s", out)
+	}
+	if !strings.Contains(out, "<hostErrors>\n"+svc2.Address()+": ") || !strings.Contains(out, "gadget not available") {
+		t.Errorf("expected the failing host to be reported, got:\n%s", out)
+	}
+
+	out, err = mgr.Run(context.Background(), "trace_exec", nil, 200*time.Millisecond, gadgetmanager.WithHosts([]string{svc2.Address()}))
+	if err == nil {
+		t.Errorf("expected running only on the failing host to fail, got:\n%s", out)
+	}
+}
+
+func TestRunDetached(t *testing.T) {
+	svc := newService(t, traceExec("curl", "sh"))
+	mgr := newManager(t, svc.Address())
+	ctx := context.Background()
+
+	id, err := mgr.RunDetached(ctx, "trace_exec", map[string]string{"operator.filter.filter": "error==0"}, nil)
+	if err != nil {
+		t.Fatalf("running gadget in background: %v", err)
+	}
+	t.Cleanup(func() { mgr.Stop(ctx, id) })
+
+	instances, err := mgr.ListGadgets(ctx)
+	if err != nil {
+		t.Fatalf("listing gadgets: %v", err)
+	}
+	if len(instances) != 1 || instances[0].ID != id || instances[0].CreatedBy != "ig-mcp-server" {
+		t.Fatalf("expected the instance to be listed, got %+v", instances)
+	}
+
+	var results strings.Builder
+	cursor := ""
+	for deadline := time.Now().Add(10 * time.Second); strings.Count(results.String(), `"proc":`) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for results, got:\n%s", results.String())
+		}
+		page, err := mgr.GetResults(ctx, id, cursor, 1)
+		if err != nil {
+			t.Fatalf("getting results: %v", err)
+		}
+		if page.Count > 1 {
+			t.Errorf("expected at most 1 event per page, got %d", page.Count)
+		}
+		results.WriteString(page.Results)
+		cursor = page.NextCursor
+	}
+	if !strings.Contains(results.String(), `"comm":"curl"`) || !strings.Contains(results.String(), `"comm":"sh"`) {
+		t.Errorf("expected the events of the instance, got:\n%s", results.String())
+	}
+
+	if err := mgr.Stop(ctx, id); err != nil {
+		t.Fatalf("stopping gadget: %v", err)
+	}
+	if instances := svc.Instances(); len(instances) != 0 {
+		t.Errorf("expected the instance to be removed, got %v", instances)
+	}
+}
+
+func TestRunDetachedHosts(t *testing.T) {
+	svc1 := newService(t, traceExec("curl"))
+	svc2 := newService(t, traceExec("sh"))
+	mgr := newManager(t, svc1.Address(), svc2.Address())
+	ctx := context.Background()
+
+	if _, err := mgr.RunDetached(ctx, "trace_exec", nil, []string{"unix:///unknown.sock"}); err == nil {
+		t.Error("expected starting the gadget on an unknown host to fail")
+	}
+
+	id, err := mgr.RunDetached(ctx, "trace_exec", nil, []string{svc2.Address()})
+	if err != nil {
+		t.Fatalf("running gadget in background: %v", err)
+	}
+	if n1, n2 := len(svc1.Instances()), len(svc2.Instances()); n1 != 0 || n2 != 1 {
+		t.Fatalf("expected the instance to only run on the selected host, got %d and %d instances", n1, n2)
+	}
+
+	var results string
+	for deadline := time.Now().Add(10 * time.Second); !strings.Contains(results, `"comm":"sh"`); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for results, got:\n%s", results)
+		}
+		page, err := mgr.GetResults(ctx, id, "", 10)
+		if err != nil {
+			t.Fatalf("getting results: %v", err)
+		}
+		if len(page.HostErrors) > 0 {
+			t.Fatalf("expected results to only be collected from the selected host, got %v", page.HostErrors)
+		}
+		results = page.Results
+	}
+
+	// only the host the instance runs on is asked to stop it
+	if err := mgr.Stop(ctx, id); err != nil {
+		t.Fatalf("stopping gadget: %v", err)
+	}
+	if instances := svc2.Instances(); len(instances) != 0 {
+		t.Errorf("expected the instance to be removed, got %v", instances)
+	}
+}
+
+func TestGetResultsPaging(t *testing.T) {
+	svc := newService(t, traceExec("a", "b", "c", "d", "e"))
+	mgr := newManager(t, svc.Address())
+	ctx := context.Background()
+
+	id, err := mgr.RunDetached(ctx, "trace_exec", nil, nil)
+	if err != nil {
+		t.Fatalf("running gadget in background: %v", err)
+	}
+	t.Cleanup(func() { mgr.Stop(ctx, id) })
+
+	var comms []string
+	cursor := ""
+	read := func() *gadgetmanager.ResultPage {
+		t.Helper()
+		page, err := mgr.GetResults(ctx, id, cursor, 2)
+		if err != nil {
+			t.Fatalf("getting results: %v", err)
+		}
+		if page.Count > 2 {
+			t.Errorf("expected at most 2 events per page, got %d", page.Count)
+		}
+		for _, line := range strings.Split(page.Results, "\n") {
+			if _, comm, ok := strings.Cut(line, `"comm":"`); ok {
+				comms = append(comms, comm[:1])
+			}
+		}
+		cursor = page.NextCursor
+		return page
+	}
+	for deadline := time.Now().Add(10 * time.Second); len(comms) < 5; {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for results, got %v", comms)
+		}
+		if page := read(); page.Completed {
+			t.Fatalf("expected the instance to be running")
+		}
+	}
+	if strings.Join(comms, "") != "abcde" {
+		t.Errorf("expected each event once in order, got %v", comms)
+	}
+
+	// the instance goes away without being stopped through the manager
+	if _, err := svc.RemoveGadgetInstance(ctx, &api.GadgetInstanceId{Id: id}); err != nil {
+		t.Fatalf("removing instance: %v", err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); !read().Completed; {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the results to complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(comms) != 5 {
+		t.Errorf("expected no more events, got %v", comms)
+	}
+
+	// the results were dropped once read completely, so the manager attaches again and fails
+	if _, err := mgr.GetResults(ctx, id, cursor, 2); err == nil {
+		t.Errorf("expected the results of the removed instance to be dropped")
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+	svc := newService(t, traceExec())
+	mgr := newManager(t, svc.Address())
+
+	info, err := mgr.GetInfo(context.Background(), "trace_exec")
+	if err != nil {
+		t.Fatalf("getting gadget info: %v", err)
+	}
+	if len(info.DataSources) != 1 || info.DataSources[0].Name != "exec" {
+		t.Errorf("expected the exec datasource, got %v", info.DataSources)
+	}
+
+	version, err := mgr.GetVersion()
+	if err != nil {
+		t.Fatalf("getting version: %v", err)
+	}
+	if version != "0.50.1" {
+		t.Errorf("expected version 0.50.1, got %q", version)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gadgetmanager
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// HostField is the field added to events to tell which host they were captured on
+// when the manager talks to more than one daemon.
+const HostField = "host"
+
+// HostErrors holds the error of each host a call failed on. Methods that fan out to
+// several hosts return it alongside their results if only some of the hosts failed.
+type HostErrors map[string]error
+
+func (e HostErrors) Error() string {
+	if err, ok := e[""]; ok && len(e) == 1 {
+		return err.Error()
+	}
+	hosts := make([]string, 0, len(e))
+	for host := range e {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	msgs := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", host, e[host]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// String formats the errors as a <hostErrors> section to be appended to results.
+func (e HostErrors) String() string {
+	if len(e) == 0 {
+		return ""
+	}
+	hosts := make([]string, 0, len(e))
+	for host := range e {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	var res strings.Builder
+	res.WriteString("\n<hostErrors>\n")
+	for _, host := range hosts {
+		fmt.Fprintf(&res, "%s: %v\n", host, e[host])
+	}
+	res.WriteString("</hostErrors>")
+	return res.String()
+}
+
+// splitHosts returns the distinct addresses of a comma-separated list.
+func splitHosts(addresses string) []string {
+	var hosts []string
+	for _, addr := range strings.Split(addresses, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" && !slices.Contains(hosts, addr) {
+			hosts = append(hosts, addr)
+		}
+	}
+	return hosts
+}
+
+// selectHosts returns the hosts a call should fan out to, all of them if none were selected.
+func (g *gadgetManager) selectHosts(selected []string) ([]string, error) {
+	if len(selected) == 0 {
+		return g.hosts, nil
+	}
+	for _, host := range selected {
+		if !slices.Contains(g.hosts, host) {
+			return nil, fmt.Errorf("unknown host %q, must be one of: %s", host, strings.Join(g.hosts, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// forEachHost calls fn concurrently for each of the given hosts and returns the
+// errors of the hosts it failed on.
+func (g *gadgetManager) forEachHost(ctx context.Context, hosts []string, fn func(ctx context.Context, host string, rt *sharedRuntime) error) HostErrors {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := HostErrors{}
+	for _, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(ctx, host, g.runtimes[host]); err != nil {
+				mu.Lock()
+				errs[host] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
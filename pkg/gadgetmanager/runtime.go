@@ -0,0 +1,166 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gadgetmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	grpcruntime "github.com/inspektor-gadget/inspektor-gadget/pkg/runtime/grpc"
+)
+
+const (
+	// maxConcurrentCalls bounds the number of concurrent calls to the gadget runtime
+	maxConcurrentCalls = 16
+	// healthCheckInterval is the time after which the runtime is checked again before being used
+	healthCheckInterval = 30 * time.Second
+	healthCheckTimeout  = 5 * time.Second
+)
+
+// sharedRuntime is a long-lived gRPC runtime shared by all calls of a gadget
+// manager. It is health checked before being reused and re-created if the check
+// fails, e.g. because the port-forward or the daemon connection broke.
+type sharedRuntime struct {
+	newRuntime func() (*grpcruntime.Runtime, error)
+	sem        chan struct{}
+
+	mu        sync.Mutex
+	rt        *grpcruntime.Runtime
+	healthy   bool
+	checkedAt time.Time
+}
+
+func newSharedRuntime(newRuntime func() (*grpcruntime.Runtime, error), maxConcurrency int) *sharedRuntime {
+	return &sharedRuntime{
+		newRuntime: newRuntime,
+		sem:        make(chan struct{}, maxConcurrency),
+	}
+}
+
+// acquire returns the shared runtime once less than maxConcurrentCalls calls are
+// in progress. The returned release function must be called with the result of
+// the call, a failed call triggers a health check before the runtime is used again.
+func (s *sharedRuntime) acquire(ctx context.Context) (*grpcruntime.Runtime, func(err error), error) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("waiting for gadget runtime: %w", ctx.Err())
+	}
+
+	rt, err := s.get(ctx)
+	if err != nil {
+		<-s.sem
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	release := func(err error) {
+		once.Do(func() {
+			// errors caused by the caller going away don't say anything about the runtime
+			if err != nil && ctx.Err() == nil {
+				s.markUnhealthy(rt)
+			}
+			<-s.sem
+		})
+	}
+	return rt, release, nil
+}
+
+// get returns the shared runtime without taking part in the concurrency limit,
+// it's meant for long-running calls like collecting results in the background.
+func (s *sharedRuntime) get(ctx context.Context) (*grpcruntime.Runtime, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rt != nil {
+		if s.healthy && time.Since(s.checkedAt) < healthCheckInterval {
+			return s.rt, nil
+		}
+		err := s.check(ctx, s.rt)
+		if err == nil {
+			s.healthy = true
+			s.checkedAt = time.Now()
+			return s.rt, nil
+		}
+		log.Warn("Gadget runtime failed health check, reconnecting", "error", err)
+		s.rt.Close()
+		s.rt = nil
+	}
+
+	rt, err := s.newRuntime()
+	if err != nil {
+		return nil, fmt.Errorf("getting runtime: %w", err)
+	}
+	s.rt = rt
+	s.healthy = true
+	s.checkedAt = time.Now()
+	return rt, nil
+}
+
+func (s *sharedRuntime) markUnhealthy(rt *grpcruntime.Runtime) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rt == rt {
+		s.healthy = false
+	}
+}
+
+// check does a cheap round trip to the gadget service.
+func (s *sharedRuntime) check(ctx context.Context, rt *grpcruntime.Runtime) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	_, err := rt.GetGadgetInstances(ctx, rt.ParamDescs().ToParams())
+	return err
+}
+
+// newRuntime creates a runtime connected to the given address in linux mode, the
+// address is ignored in kubernetes mode.
+func (g *gadgetManager) newRuntime(addr string) (*grpcruntime.Runtime, error) {
+	if g.env == "kubernetes" {
+		rt := grpcruntime.New(grpcruntime.WithConnectUsingK8SProxy)
+		gp := rt.GlobalParamDescs().ToParams()
+		if g.gadgetNamespace != "" {
+			if err := gp.Set(grpcruntime.ParamGadgetNamespace, g.gadgetNamespace); err != nil {
+				return nil, fmt.Errorf("setting gadget namespace: %w", err)
+			}
+		}
+		if err := rt.Init(gp); err != nil {
+			return nil, fmt.Errorf("initializing gadget runtime: %w", err)
+		}
+
+		restConfig, err := g.k8sConfig.ToRESTConfig()
+		if err != nil {
+			return nil, fmt.Errorf("creating REST config: %w", err)
+		}
+		rt.SetRestConfig(restConfig)
+
+		return rt, nil
+	}
+	if g.env == "linux" {
+		rt := grpcruntime.New()
+		gp := rt.GlobalParamDescs().ToParams()
+		err := gp.Set(grpcruntime.ParamRemoteAddress, addr)
+		if err != nil {
+			return nil, fmt.Errorf("setting remote address: %w", err)
+		}
+		if err = rt.Init(gp); err != nil {
+			return nil, fmt.Errorf("initializing gadget runtime: %w", err)
+		}
+		return rt, nil
+	}
+	return nil, fmt.Errorf("unsupported gadget manager environment: %s", g.env)
+}
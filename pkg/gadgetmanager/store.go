@@ -0,0 +1,201 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gadgetmanager
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/capture"
+)
+
+const (
+	// maxStoredEvents is the number of events kept per gadget instance, older events are dropped
+	maxStoredEvents = 10000
+	// DefaultPageLimit is the number of events returned by GetResults if no limit is given
+	DefaultPageLimit = 500
+	// MaxPageLimit is the maximum number of events returned by a single GetResults call
+	MaxPageLimit = 5000
+	// storeTTL is the time the events of a finished instance are kept if they aren't read completely
+	storeTTL = 10 * time.Minute
+)
+
+// ResultPage is a page of events read from a gadget instance running in the background.
+type ResultPage struct {
+	// Results holds the formatted events of this page
+	Results string
+	// Count is the number of events in this page
+	Count int
+	// NextCursor is the cursor to pass to the next call to continue after this page
+	NextCursor string
+	// Skipped is the number of events between the requested cursor and this page that
+	// were dropped because the store was full
+	Skipped uint64
+	// Completed is true once the instance stopped producing events and all of them were returned
+	Completed bool
+	// HostErrors holds the errors of the hosts events could not be collected from
+	HostErrors HostErrors
+	// Capture describes where the raw packets received so far can be found, if any
+	Capture string
+}
+
+// resultStore keeps the events of a single gadget instance, addressed by a
+// monotonically increasing offset. Events of all hosts the instance runs on are
+// merged in the order they arrive.
+type resultStore struct {
+	mu     sync.Mutex
+	events []string
+	// base is the offset of events[0]
+	base    uint64
+	max     int
+	hosts   []string
+	cancel  func()
+	capture *capture.Capture
+	// pending is the number of hosts that are still being collected from
+	pending int
+	done    bool
+	// finished is the time collecting from all hosts stopped
+	finished time.Time
+	errs     HostErrors
+	// ready is closed after the first event was received or the collector finished
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+func newResultStore(max int, hosts []string, cancel func()) *resultStore {
+	return &resultStore{
+		max:     max,
+		hosts:   hosts,
+		cancel:  cancel,
+		pending: len(hosts),
+		errs:    HostErrors{},
+		ready:   make(chan struct{}),
+	}
+}
+
+func (s *resultStore) append(buf []byte) {
+	s.mu.Lock()
+	s.events = append(s.events, string(buf))
+	if len(s.events) > s.max {
+		drop := len(s.events) - s.max
+		s.events = s.events[drop:]
+		s.base += uint64(drop)
+	}
+	s.mu.Unlock()
+	s.readyOnce.Do(func() { close(s.ready) })
+}
+
+// finish records that collecting from host stopped.
+func (s *resultStore) finish(host string, err error) {
+	s.mu.Lock()
+	s.pending--
+	s.done = s.pending <= 0
+	if s.done {
+		s.finished = time.Now()
+	}
+	if err != nil {
+		s.errs[host] = err
+	}
+	done := s.done
+	s.mu.Unlock()
+	if done {
+		s.readyOnce.Do(func() { close(s.ready) })
+	}
+}
+
+// failed returns the errors of the hosts if collecting failed on all of them.
+func (s *resultStore) failed() HostErrors {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.done || len(s.errs) < len(s.hosts) {
+		return nil
+	}
+	return maps.Clone(s.errs)
+}
+
+func (s *resultStore) close() {
+	s.cancel()
+}
+
+// expired returns true if collecting stopped more than ttl before now.
+func (s *resultStore) expired(now time.Time, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done && now.Sub(s.finished) > ttl
+}
+
+// empty returns true if the store never received any event.
+func (s *resultStore) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.base == 0 && len(s.events) == 0
+}
+
+// page returns up to limit events starting at cursor while keeping the
+// formatted output below maxLen bytes.
+func (s *resultStore) page(cursor string, limit int, maxLen int) (*ResultPage, error) {
+	var offset uint64
+	if cursor != "" {
+		var err error
+		offset, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %q: must be a value returned as next cursor", cursor)
+		}
+	}
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	limit = min(limit, MaxPageLimit)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.base + uint64(len(s.events))
+	if offset > next {
+		return nil, fmt.Errorf("invalid cursor %q: only %d events were received so far", cursor, next)
+	}
+
+	page := &ResultPage{}
+	if offset < s.base {
+		page.Skipped = s.base - offset
+		offset = s.base
+	}
+
+	var res strings.Builder
+	for i := int(offset - s.base); i < len(s.events) && page.Count < limit; i++ {
+		ev := s.events[i]
+		// always return at least one event so the cursor can advance
+		if page.Count > 0 && res.Len()+len(ev)+1 > maxLen {
+			break
+		}
+		res.WriteString(ev)
+		res.WriteByte('\n')
+		page.Count++
+	}
+	page.Results = fmt.Sprintf("\n<results>%s</results>\n", res.String())
+	page.NextCursor = strconv.FormatUint(offset+uint64(page.Count), 10)
+	page.Completed = s.done && offset+uint64(page.Count) == next
+	if len(s.errs) > 0 {
+		page.HostErrors = maps.Clone(s.errs)
+	}
+	if s.capture != nil {
+		page.Capture = s.capture.Summary()
+	}
+	return page, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gadgetmanager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store keeping up to max events that received n events e0...e(n-1).
+func newTestStore(max int, n int, hosts ...string) *resultStore {
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	s := newResultStore(max, hosts, func() {})
+	for i := range n {
+		s.append([]byte(fmt.Sprintf("e%d", i)))
+	}
+	return s
+}
+
+func pageEvents(p *ResultPage) []string {
+	res := strings.TrimSuffix(strings.TrimPrefix(p.Results, "\n<results>"), "</results>\n")
+	return strings.Fields(res)
+}
+
+func TestResultStorePage(t *testing.T) {
+	tests := []struct {
+		name        string
+		store       *resultStore
+		cursor      string
+		limit       int
+		maxLen      int
+		first       string
+		count       int
+		next        string
+		skipped     uint64
+		expectedErr string
+	}{
+		{name: "from the start", store: newTestStore(100, 10), limit: 4, maxLen: 1000, first: "e0", count: 4, next: "4"},
+		{name: "from a cursor", store: newTestStore(100, 10), cursor: "4", limit: 4, maxLen: 1000, first: "e4", count: 4, next: "8"},
+		{name: "up to the last event", store: newTestStore(100, 10), cursor: "8", limit: 4, maxLen: 1000, first: "e8", count: 2, next: "10"},
+		{name: "nothing new", store: newTestStore(100, 10), cursor: "10", limit: 4, maxLen: 1000, count: 0, next: "10"},
+		{name: "default limit", store: newTestStore(maxStoredEvents, DefaultPageLimit+10), maxLen: 1 << 20, first: "e0", count: DefaultPageLimit, next: fmt.Sprint(DefaultPageLimit)},
+		{name: "maximum limit", store: newTestStore(maxStoredEvents, MaxPageLimit+10), limit: MaxPageLimit + 1, maxLen: 1 << 20, first: "e0", count: MaxPageLimit, next: fmt.Sprint(MaxPageLimit)},
+		// each event takes 3 bytes including the newline
+		{name: "cut at maxLen", store: newTestStore(100, 10), limit: 10, maxLen: 7, first: "e0", count: 2, next: "2"},
+		{name: "at least one event", store: newTestStore(100, 10), limit: 10, maxLen: 1, first: "e0", count: 1, next: "1"},
+		{name: "evicted events", store: newTestStore(5, 10), cursor: "2", limit: 10, maxLen: 1000, first: "e5", count: 5, next: "10", skipped: 3},
+		{name: "cursor ahead", store: newTestStore(100, 10), cursor: "11", expectedErr: "only 10 events were received so far"},
+		{name: "invalid cursor", store: newTestStore(100, 10), cursor: "abc", expectedErr: "must be a value returned as next cursor"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := tc.store.page(tc.cursor, tc.limit, tc.maxLen)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events := pageEvents(page)
+			if page.Count != tc.count || len(events) != tc.count {
+				t.Fatalf("expected %d events, got %d: %v", tc.count, page.Count, events)
+			}
+			if tc.count > 0 && events[0] != tc.first {
+				t.Errorf("expected the page to start at %s, got %s", tc.first, events[0])
+			}
+			if page.NextCursor != tc.next {
+				t.Errorf("expected next cursor %s, got %s", tc.next, page.NextCursor)
+			}
+			if page.Skipped != tc.skipped {
+				t.Errorf("expected %d skipped events, got %d", tc.skipped, page.Skipped)
+			}
+		})
+	}
+}
+
+func TestResultStorePageContinuity(t *testing.T) {
+	s := newTestStore(100, 7)
+	var got []string
+	cursor := ""
+	for range 10 {
+		page, err := s.page(cursor, 3, 1000)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, pageEvents(page)...)
+		cursor = page.NextCursor
+		// events arriving between two calls continue the same sequence
+		if len(got) == 3 {
+			s.append([]byte("e7"))
+		}
+	}
+	if strings.Join(got, " ") != "e0 e1 e2 e3 e4 e5 e6 e7" {
+		t.Errorf("expected every event exactly once in order, got %v", got)
+	}
+}
+
+func TestResultStorePageCompleted(t *testing.T) {
+	s := newTestStore(100, 4, "host1", "host2")
+	failure := errors.New("connection refused")
+
+	page, err := s.page("", 2, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if page.Completed || page.HostErrors != nil {
+		t.Fatalf("expected a running instance without errors, got %+v", page)
+	}
+
+	s.finish("host1", nil)
+	s.finish("host2", failure)
+	if s.failed() != nil {
+		t.Errorf("expected collecting not to fail if one host succeeded")
+	}
+
+	page, err = s.page("", 2, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if page.Completed {
+		t.Errorf("expected the page not to be completed while events are left")
+	}
+	if !errors.Is(page.HostErrors["host2"], failure) || len(page.HostErrors) != 1 {
+		t.Errorf("expected the error of host2, got %v", page.HostErrors)
+	}
+
+	page, err = s.page(page.NextCursor, 2, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !page.Completed {
+		t.Errorf("expected the page to be completed once all events were read")
+	}
+}
+
+func TestEvictStores(t *testing.T) {
+	running := newTestStore(100, 1)
+	read := newTestStore(100, 1)
+	read.finish("", nil)
+	expired := newTestStore(100, 1)
+	expired.finish("", nil)
+
+	g := &gadgetManager{stores: map[string]*resultStore{
+		"running": running,
+		"read":    read,
+		"expired": expired,
+	}}
+	g.dropStore("read", read)
+	g.evictStores(time.Now())
+	if len(g.stores) != 2 {
+		t.Fatalf("expected only the read store to be removed, got %v", g.stores)
+	}
+
+	g.evictStores(time.Now().Add(storeTTL + time.Second))
+	if _, ok := g.stores["running"]; !ok || len(g.stores) != 1 {
+		t.Errorf("expected only the store of the running instance to be kept, got %v", g.stores)
+	}
+}
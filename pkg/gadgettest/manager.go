@@ -0,0 +1,206 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gadgettest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/output"
+)
+
+// Call is a call made to a Manager.
+type Call struct {
+	Method string
+	// Image is the image or the instance ID the call was made for
+	Image   string
+	Params  map[string]string
+	Timeout time.Duration
+	// Options is the number of run options passed
+	Options int
+	// Hosts holds the hosts a gadget was started on in the background
+	Hosts []string
+}
+
+// Manager is a scripted gadgetmanager.GadgetManager. It answers with the canned
+// values it is set up with and records all calls, so that tools can be tested
+// without a gadget service. The fields must not be changed while it's in use.
+type Manager struct {
+	// Infos holds the gadget infos returned by GetInfo by image
+	Infos map[string]*api.GadgetInfo
+	// Results holds the output of Run by image
+	Results map[string]string
+	// Pages holds the pages returned by GetResults by instance ID, one per call
+	Pages map[string][]*gadgetmanager.ResultPage
+	// Version is returned by GetVersion, an empty version fails the call
+	Version string
+	// HostList is returned by Hosts
+	HostList []string
+	// Budget is returned by ResultBudget, output.DefaultBudget if not set
+	Budget output.Budget
+	// Err fails all calls if set
+	Err error
+	// InfoFunc replaces the canned infos of GetInfo if set
+	InfoFunc func(ctx context.Context, image string) (*api.GadgetInfo, error)
+	// RunFunc replaces the canned results of Run if set
+	RunFunc func(ctx context.Context, image string, params map[string]string, timeout time.Duration, opts ...gadgetmanager.RunOption) (string, error)
+
+	mu        sync.Mutex
+	calls     []Call
+	instances []*gadgetmanager.GadgetInstance
+	nextID    int
+}
+
+var _ gadgetmanager.GadgetManager = (*Manager)(nil)
+
+// Calls returns the calls made so far, in order.
+func (m *Manager) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.calls)
+}
+
+func (m *Manager) record(c Call) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.Params = maps.Clone(c.Params)
+	m.calls = append(m.calls, c)
+}
+
+func (m *Manager) Run(ctx context.Context, image string, params map[string]string, timeout time.Duration, opts ...gadgetmanager.RunOption) (string, error) {
+	m.record(Call{Method: "Run", Image: image, Params: params, Timeout: timeout, Options: len(opts)})
+	if m.Err != nil {
+		return "", m.Err
+	}
+	if m.RunFunc != nil {
+		return m.RunFunc(ctx, image, params, timeout, opts...)
+	}
+	res, ok := m.Results[image]
+	if !ok {
+		return "", fmt.Errorf("gadget %q not found", image)
+	}
+	return res, nil
+}
+
+func (m *Manager) RunDetached(ctx context.Context, image string, params map[string]string, hosts []string) (string, error) {
+	m.record(Call{Method: "RunDetached", Image: image, Params: params, Hosts: hosts})
+	if m.Err != nil {
+		return "", m.Err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	id := fmt.Sprintf("%032x", m.nextID)
+	m.instances = append(m.instances, &gadgetmanager.GadgetInstance{
+		ID:          id,
+		GadgetImage: image,
+		CreatedBy:   "ig-mcp-server",
+	})
+	return id, nil
+}
+
+func (m *Manager) GetResults(ctx context.Context, id string, cursor string, limit int) (*gadgetmanager.ResultPage, error) {
+	m.record(Call{Method: "GetResults", Image: id})
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pages := m.Pages[id]
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no results for gadget %q", id)
+	}
+	// the last page is repeated once all were returned
+	page := pages[0]
+	if len(pages) > 1 {
+		m.Pages[id] = pages[1:]
+	}
+	return page, nil
+}
+
+func (m *Manager) Stop(ctx context.Context, id string) error {
+	m.record(Call{Method: "Stop", Image: id})
+	if m.Err != nil {
+		return m.Err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.instances, func(inst *gadgetmanager.GadgetInstance) bool {
+		return inst.ID == id
+	})
+	if i < 0 {
+		return fmt.Errorf("gadget instance %q not found", id)
+	}
+	m.instances = slices.Delete(m.instances, i, i+1)
+	return nil
+}
+
+func (m *Manager) GetInfo(ctx context.Context, image string) (*api.GadgetInfo, error) {
+	m.record(Call{Method: "GetInfo", Image: image})
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if m.InfoFunc != nil {
+		return m.InfoFunc(ctx, image)
+	}
+	info, ok := m.Infos[image]
+	if !ok {
+		return nil, fmt.Errorf("gadget %q not found", image)
+	}
+	return info, nil
+}
+
+func (m *Manager) GetVersion() (string, error) {
+	m.record(Call{Method: "GetVersion"})
+	if m.Err != nil {
+		return "", m.Err
+	}
+	if m.Version == "" {
+		return "", fmt.Errorf("no version set")
+	}
+	return m.Version, nil
+}
+
+func (m *Manager) ListGadgets(ctx context.Context) ([]*gadgetmanager.GadgetInstance, error) {
+	m.record(Call{Method: "ListGadgets"})
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.instances), nil
+}
+
+func (m *Manager) Hosts() []string {
+	return m.HostList
+}
+
+func (m *Manager) ResultBudget() output.Budget {
+	if m.Budget.Size == 0 {
+		return output.DefaultBudget
+	}
+	return m.Budget
+}
@@ -0,0 +1,587 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gadgettest provides a scripted GadgetManager and an in-process fake of
+// the Inspektor Gadget gadget service to test tools and the output pipeline
+// without a cluster.
+package gadgettest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/datasource"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+)
+
+// Gadget is a gadget served by the fake Service.
+type Gadget struct {
+	// Image is the name the gadget is run with
+	Image string
+	// Metadata is the content of the gadget's metadata file
+	Metadata string
+	Params   []*api.Param
+	// DataSources describe the layout of the events
+	DataSources []DataSource
+	// Events are emitted in order when the gadget is run or an instance of it is attached to
+	Events []Event
+	// Interval is the time between two events
+	Interval time.Duration
+	// Err fails getting the info and running the gadget if set
+	Err error
+}
+
+// Info returns the gadget info the Service serves for g, e.g. to set up a Manager
+// with the same gadgets.
+func (g *Gadget) Info() (*api.GadgetInfo, error) {
+	sg, err := newServedGadget(g)
+	if err != nil {
+		return nil, err
+	}
+	return sg.info, nil
+}
+
+// DataSource describes a datasource of a Gadget.
+type DataSource struct {
+	Name        string
+	Annotations map[string]string
+	Fields      []Field
+}
+
+// Field describes a field of a DataSource. Sub fields are created by using a dotted
+// name like proc.comm, the parent fields are created as needed.
+type Field struct {
+	Name        string
+	Kind        api.Kind
+	Tags        []string
+	Annotations map[string]string
+}
+
+// Event is a single event emitted by a Gadget.
+type Event struct {
+	// DataSource is the name of the datasource of the event, it can be left empty if
+	// the gadget only has one datasource
+	DataSource string
+	// Values holds the values of the fields by their full name, fields without a
+	// value are left zero
+	Values map[string]any
+}
+
+// Service is an in-process gadget service serving canned gadgets over a unix
+// socket, the way the ig daemon does. Point a gadget manager at Address() in linux
+// mode to exercise the whole pipeline without a cluster or eBPF.
+type Service struct {
+	api.UnimplementedBuiltInGadgetManagerServer
+	api.UnimplementedGadgetManagerServer
+	api.UnimplementedGadgetInstanceManagerServer
+
+	version string
+	path    string
+	server  *grpc.Server
+	done    chan struct{}
+
+	mu        sync.Mutex
+	gadgets   map[string]*servedGadget
+	instances map[string]*instance
+	runs      []*api.GadgetRunRequest
+}
+
+type servedGadget struct {
+	gadget   *Gadget
+	info     *api.GadgetInfo
+	payloads []*api.GadgetEvent
+}
+
+type instance struct {
+	*api.GadgetInstance
+	gadget  *servedGadget
+	removed chan struct{}
+}
+
+// NewService starts serving the given gadgets on a unix socket in dir until Close
+// is called. The version is reported as the version of Inspektor Gadget.
+func NewService(dir string, version string, gadgets ...*Gadget) (*Service, error) {
+	s := &Service{
+		version:   version,
+		path:      filepath.Join(dir, "ig.socket"),
+		server:    grpc.NewServer(),
+		done:      make(chan struct{}),
+		gadgets:   make(map[string]*servedGadget),
+		instances: make(map[string]*instance),
+	}
+	for _, g := range gadgets {
+		sg, err := newServedGadget(g)
+		if err != nil {
+			return nil, fmt.Errorf("preparing gadget %s: %w", g.Image, err)
+		}
+		s.gadgets[g.Image] = sg
+	}
+
+	lis, err := net.Listen("unix", s.path)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", s.path, err)
+	}
+	api.RegisterBuiltInGadgetManagerServer(s.server, s)
+	api.RegisterGadgetManagerServer(s.server, s)
+	api.RegisterGadgetInstanceManagerServer(s.server, s)
+	go s.server.Serve(lis)
+	return s, nil
+}
+
+// Address returns the address to connect to the service, as expected by the
+// linux remote address of the gadget manager.
+func (s *Service) Address() string {
+	return "unix://" + s.path
+}
+
+// Close stops the service, running gadgets are ended.
+func (s *Service) Close() {
+	close(s.done)
+	s.server.Stop()
+	os.Remove(s.path)
+}
+
+// Runs returns the requests the gadgets were run with so far, in order.
+func (s *Service) Runs() []*api.GadgetRunRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*api.GadgetRunRequest(nil), s.runs...)
+}
+
+// Instances returns the gadget instances that are currently running.
+func (s *Service) Instances() []*api.GadgetInstance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	instances := make([]*api.GadgetInstance, 0, len(s.instances))
+	for _, inst := range s.instances {
+		instances = append(instances, inst.GadgetInstance)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Id < instances[j].Id
+	})
+	return instances
+}
+
+func (s *Service) GetInfo(ctx context.Context, req *api.InfoRequest) (*api.InfoResponse, error) {
+	return &api.InfoResponse{
+		Version:       "1.0",
+		ServerVersion: s.version,
+	}, nil
+}
+
+func (s *Service) GetGadgetInfo(ctx context.Context, req *api.GetGadgetInfoRequest) (*api.GetGadgetInfoResponse, error) {
+	var g *servedGadget
+	var err error
+	if req.Flags&api.GadgetInfoRequestFlagUseInstance != 0 {
+		g, err = s.instanceGadget(req.ImageName)
+	} else {
+		g, err = s.gadget(req.ImageName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.GetGadgetInfoResponse{GadgetInfo: g.info}, nil
+}
+
+func (s *Service) RunGadget(stream api.GadgetManager_RunGadgetServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	var g *servedGadget
+	var timeout time.Duration
+	removed := make(chan struct{})
+	switch ev := req.Event.(type) {
+	case *api.GadgetControlRequest_RunRequest:
+		s.mu.Lock()
+		s.runs = append(s.runs, ev.RunRequest)
+		s.mu.Unlock()
+		g, err = s.gadget(ev.RunRequest.ImageName)
+		timeout = time.Duration(ev.RunRequest.Timeout)
+	case *api.GadgetControlRequest_AttachRequest:
+		s.mu.Lock()
+		inst, ok := s.instances[ev.AttachRequest.Id]
+		s.mu.Unlock()
+		if !ok {
+			return status.Errorf(codes.NotFound, "gadget instance %q not found", ev.AttachRequest.Id)
+		}
+		g, removed = inst.gadget, inst.removed
+	default:
+		return status.Error(codes.InvalidArgument, "expected run or attach request")
+	}
+	if err != nil {
+		return err
+	}
+
+	// the client asks to stop by sending a stop request or closing the stream
+	stopped := make(chan struct{})
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				close(stopped)
+				return
+			}
+			if _, ok := msg.Event.(*api.GadgetControlRequest_StopRequest); ok {
+				close(stopped)
+				return
+			}
+		}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	wait := func(d time.Duration) bool {
+		var after <-chan time.Time
+		if d >= 0 {
+			after = time.After(d)
+		}
+		select {
+		case <-after:
+			return true
+		case <-stopped:
+		case <-removed:
+		case <-expired:
+		case <-s.done:
+		case <-stream.Context().Done():
+		}
+		return false
+	}
+
+	info, err := proto.Marshal(g.info)
+	if err != nil {
+		return fmt.Errorf("marshaling gadget info: %w", err)
+	}
+	if err := stream.Send(&api.GadgetEvent{Type: api.EventTypeGadgetInfo, Payload: info}); err != nil {
+		return err
+	}
+	for i, ev := range g.payloads {
+		if i > 0 && !wait(g.gadget.Interval) {
+			return nil
+		}
+		if err := stream.Send(ev); err != nil {
+			return err
+		}
+	}
+	// keep running like a real gadget until told otherwise
+	wait(-1)
+	return nil
+}
+
+func (s *Service) CreateGadgetInstance(ctx context.Context, req *api.CreateGadgetInstanceRequest) (*api.CreateGadgetInstanceResponse, error) {
+	inst := req.GadgetInstance
+	if inst == nil || inst.GadgetConfig == nil {
+		return nil, status.Error(codes.InvalidArgument, "gadget instance is missing")
+	}
+	g, err := s.gadget(inst.GadgetConfig.ImageName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.instances[inst.Id]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "gadget instance %q already exists", inst.Id)
+	}
+	inst = proto.Clone(inst).(*api.GadgetInstance)
+	inst.TimeCreated = time.Now().Unix()
+	inst.State = &api.GadgetInstanceState{Status: api.GadgetInstanceStatus_StatusRunning}
+	s.instances[inst.Id] = &instance{
+		GadgetInstance: inst,
+		gadget:         g,
+		removed:        make(chan struct{}),
+	}
+	return &api.CreateGadgetInstanceResponse{GadgetInstance: inst}, nil
+}
+
+func (s *Service) ListGadgetInstances(ctx context.Context, req *api.ListGadgetInstancesRequest) (*api.ListGadgetInstanceResponse, error) {
+	return &api.ListGadgetInstanceResponse{GadgetInstances: s.Instances()}, nil
+}
+
+func (s *Service) GetGadgetInstance(ctx context.Context, req *api.GadgetInstanceId) (*api.GadgetInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.instances[req.Id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "gadget instance %q not found", req.Id)
+	}
+	return inst.GadgetInstance, nil
+}
+
+func (s *Service) RemoveGadgetInstance(ctx context.Context, req *api.GadgetInstanceId) (*api.StatusResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.instances[req.Id]
+	if !ok {
+		return &api.StatusResponse{Result: 1, Message: fmt.Sprintf("gadget instance %q not found", req.Id)}, nil
+	}
+	close(inst.removed)
+	delete(s.instances, req.Id)
+	return &api.StatusResponse{}, nil
+}
+
+func (s *Service) gadget(image string) (*servedGadget, error) {
+	s.mu.Lock()
+	g, ok := s.gadgets[image]
+	s.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "gadget %q not found", image)
+	}
+	if g.gadget.Err != nil {
+		return nil, g.gadget.Err
+	}
+	return g, nil
+}
+
+func (s *Service) instanceGadget(id string) (*servedGadget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst, ok := s.instances[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "gadget instance %q not found", id)
+	}
+	return inst.gadget, nil
+}
+
+// newServedGadget builds the gadget info and serializes the events of g the same
+// way the gadget service does, so that clients decode them like real ones.
+func newServedGadget(g *Gadget) (*servedGadget, error) {
+	info := &api.GadgetInfo{
+		Id:        g.Image,
+		ImageName: g.Image,
+		Metadata:  []byte(g.Metadata),
+		Params:    g.Params,
+	}
+
+	dataSources := make(map[string]datasource.DataSource)
+	ids := make(map[string]uint32)
+	sorted := append([]DataSource(nil), g.DataSources...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	for i, d := range sorted {
+		ds, err := newDataSource(d)
+		if err != nil {
+			return nil, fmt.Errorf("creating datasource %s: %w", d.Name, err)
+		}
+		dataSources[d.Name] = ds
+		ids[d.Name] = uint32(i)
+		info.DataSources = append(info.DataSources, &api.DataSource{
+			Id:          uint32(i),
+			Type:        uint32(ds.Type()),
+			Name:        ds.Name(),
+			Fields:      ds.Fields(),
+			Tags:        ds.Tags(),
+			Annotations: ds.Annotations(),
+		})
+	}
+
+	sg := &servedGadget{gadget: g, info: info}
+	for i, ev := range g.Events {
+		name := ev.DataSource
+		if name == "" && len(g.DataSources) == 1 {
+			name = g.DataSources[0].Name
+		}
+		ds, ok := dataSources[name]
+		if !ok {
+			return nil, fmt.Errorf("event %d: unknown datasource %q", i, name)
+		}
+		payload, err := newPayload(ds, ev.Values)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		sg.payloads = append(sg.payloads, &api.GadgetEvent{
+			Type:         api.EventTypeGadgetPayload,
+			Payload:      payload,
+			DataSourceID: ids[name],
+			Seq:          uint32(i + 1),
+		})
+	}
+	return sg, nil
+}
+
+func newDataSource(d DataSource) (datasource.DataSource, error) {
+	ds, err := datasource.New(datasource.TypeSingle, d.Name)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range d.Annotations {
+		ds.AddAnnotation(k, v)
+	}
+	for _, f := range d.Fields {
+		opts := []datasource.FieldOption{
+			datasource.WithTags(f.Tags...),
+			datasource.WithAnnotations(f.Annotations),
+		}
+		parent, name := parentField(f.Name)
+		if parent == nil {
+			if _, err := ds.AddField(name, f.Kind, opts...); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		acc, err := ensureField(ds, parent)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := acc.AddSubField(name, f.Kind, opts...); err != nil {
+			return nil, err
+		}
+	}
+	return ds, nil
+}
+
+// parentField splits a dotted field name into its parent path and its own name.
+func parentField(fullName string) ([]string, string) {
+	parts := strings.Split(fullName, ".")
+	if len(parts) == 1 {
+		return nil, fullName
+	}
+	return parts[:len(parts)-1], parts[len(parts)-1]
+}
+
+// ensureField returns the field with the given path, creating empty container
+// fields for the missing parts.
+func ensureField(ds datasource.DataSource, path []string) (datasource.FieldAccessor, error) {
+	var acc datasource.FieldAccessor
+	for i, name := range path {
+		if f := ds.GetField(strings.Join(path[:i+1], ".")); f != nil {
+			acc = f
+			continue
+		}
+		flags := datasource.WithFlags(datasource.FieldFlagContainer | datasource.FieldFlagEmpty)
+		var err error
+		if acc == nil {
+			acc, err = ds.AddField(name, 0, flags)
+		} else {
+			acc, err = acc.AddSubField(name, 0, flags)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+func newPayload(ds datasource.DataSource, values map[string]any) ([]byte, error) {
+	p, err := ds.NewPacketSingle()
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range values {
+		f := ds.GetField(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		if err := putValue(f, p, value); err != nil {
+			return nil, fmt.Errorf("setting field %q: %w", name, err)
+		}
+	}
+	return proto.Marshal(p.Raw())
+}
+
+func putValue(f datasource.FieldAccessor, d datasource.Data, value any) error {
+	switch f.Type() {
+	case api.Kind_String, api.Kind_CString:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+		return f.PutString(d, s)
+	case api.Kind_Bytes:
+		b, ok := value.([]byte)
+		if !ok {
+			return fmt.Errorf("expected []byte, got %T", value)
+		}
+		return f.PutBytes(d, b)
+	case api.Kind_Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected bool, got %T", value)
+		}
+		return f.PutBool(d, b)
+	case api.Kind_Float32, api.Kind_Float64:
+		v, err := toFloat(value)
+		if err != nil {
+			return err
+		}
+		if f.Type() == api.Kind_Float32 {
+			return f.PutFloat32(d, float32(v))
+		}
+		return f.PutFloat64(d, v)
+	}
+
+	v, err := toInt(value)
+	if err != nil {
+		return err
+	}
+	switch f.Type() {
+	case api.Kind_Int8:
+		return f.PutInt8(d, int8(v))
+	case api.Kind_Int16:
+		return f.PutInt16(d, int16(v))
+	case api.Kind_Int32:
+		return f.PutInt32(d, int32(v))
+	case api.Kind_Int64:
+		return f.PutInt64(d, v)
+	case api.Kind_Uint8:
+		return f.PutUint8(d, uint8(v))
+	case api.Kind_Uint16:
+		return f.PutUint16(d, uint16(v))
+	case api.Kind_Uint32:
+		return f.PutUint32(d, uint32(v))
+	case api.Kind_Uint64:
+		return f.PutUint64(d, uint64(v))
+	}
+	return fmt.Errorf("unsupported kind %s", f.Type())
+}
+
+func toInt(value any) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	}
+	return 0, fmt.Errorf("expected integer, got %T", value)
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("expected number, got %T", value)
+}
@@ -0,0 +1,302 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	countColumn = "count"
+
+	orderAsc  = "asc"
+	orderDesc = "desc"
+)
+
+// Aggregation describes how events are grouped and summarized before being returned.
+type Aggregation struct {
+	// GroupBy lists the fields to group events by
+	GroupBy []string `json:"group_by"`
+	// Sum, Min, Max and Avg list the fields to compute the respective function for
+	Sum []string `json:"sum,omitempty"`
+	Min []string `json:"min,omitempty"`
+	Max []string `json:"max,omitempty"`
+	Avg []string `json:"avg,omitempty"`
+	// OrderBy is the column to sort groups by, defaults to count
+	OrderBy string `json:"order_by,omitempty"`
+	// Order is the direction groups are sorted in, asc or desc (default)
+	Order string `json:"order,omitempty"`
+	// Top limits the number of returned groups, 0 returns all groups
+	Top int `json:"top,omitempty"`
+}
+
+type metric struct {
+	fn     string
+	field  string
+	column string
+}
+
+func (a *Aggregation) metrics() []metric {
+	var metrics []metric
+	for _, m := range []struct {
+		fn     string
+		fields []string
+	}{
+		{"sum", a.Sum},
+		{"min", a.Min},
+		{"max", a.Max},
+		{"avg", a.Avg},
+	} {
+		for _, f := range m.fields {
+			metrics = append(metrics, metric{fn: m.fn, field: f, column: fmt.Sprintf("%s(%s)", m.fn, f)})
+		}
+	}
+	return metrics
+}
+
+// Columns returns the names of the columns of the aggregated rows.
+func (a *Aggregation) Columns() []string {
+	columns := slices.Clone(a.GroupBy)
+	columns = append(columns, countColumn)
+	for _, m := range a.metrics() {
+		columns = append(columns, m.column)
+	}
+	return columns
+}
+
+// Fields returns all fields referenced by the aggregation.
+func (a *Aggregation) Fields() []string {
+	var fields []string
+	for _, names := range [][]string{a.GroupBy, a.Sum, a.Min, a.Max, a.Avg} {
+		for _, n := range names {
+			if !slices.Contains(fields, n) {
+				fields = append(fields, n)
+			}
+		}
+	}
+	return fields
+}
+
+// Validate checks that the aggregation only references known leaf fields. Records are
+// flattened, so they never hold parent fields such as k8s.
+func (a *Aggregation) Validate(fields []string) error {
+	if len(a.GroupBy) == 0 {
+		return fmt.Errorf("group_by must contain at least one field")
+	}
+	if a.Top < 0 {
+		return fmt.Errorf("top must not be negative")
+	}
+	leaves := slices.DeleteFunc(slices.Clone(fields), func(f string) bool { return !isLeaf(fields, f) })
+	for _, c := range []struct {
+		kind  string
+		names []string
+	}{
+		{"group_by", a.GroupBy},
+		{"sum", a.Sum},
+		{"min", a.Min},
+		{"max", a.Max},
+		{"avg", a.Avg},
+	} {
+		for _, n := range c.names {
+			if !slices.Contains(fields, n) {
+				return fmt.Errorf("unknown field %q in %s, must be one of: %s", n, c.kind, strings.Join(leaves, ", "))
+			}
+			if sub := subFields(fields, n); len(sub) > 0 {
+				return fmt.Errorf("field %q in %s is a parent field, use its leaf fields instead: %s", n, c.kind, strings.Join(sub, ", "))
+			}
+		}
+	}
+	if a.OrderBy != "" && !slices.Contains(a.Columns(), a.OrderBy) {
+		return fmt.Errorf("invalid order_by %q, must be one of: %s", a.OrderBy, strings.Join(a.Columns(), ", "))
+	}
+	if a.Order != "" && a.Order != orderAsc && a.Order != orderDesc {
+		return fmt.Errorf("invalid order %q, must be %s or %s", a.Order, orderAsc, orderDesc)
+	}
+	return nil
+}
+
+// isLeaf returns true if no other field is nested below the given one.
+func isLeaf(fields []string, name string) bool {
+	return !slices.ContainsFunc(fields, func(f string) bool { return strings.HasPrefix(f, name+".") })
+}
+
+// subFields returns the leaf fields below the given field.
+func subFields(fields []string, name string) []string {
+	var sub []string
+	for _, f := range fields {
+		if strings.HasPrefix(f, name+".") && isLeaf(fields, f) {
+			sub = append(sub, f)
+		}
+	}
+	return sub
+}
+
+type group struct {
+	keys    []any
+	count   int
+	sums    map[string]float64
+	samples map[string]int
+	mins    map[string]any
+	maxs    map[string]any
+}
+
+// Aggregator groups records according to an Aggregation. It is not safe for concurrent use.
+type Aggregator struct {
+	agg     Aggregation
+	metrics []metric
+	groups  map[string]*group
+	order   []string
+	events  int
+}
+
+// NewAggregator creates a new aggregator for the given aggregation.
+func NewAggregator(agg Aggregation) *Aggregator {
+	return &Aggregator{
+		agg:     agg,
+		metrics: agg.metrics(),
+		groups:  make(map[string]*group),
+	}
+}
+
+// Add adds a record to its group.
+func (a *Aggregator) Add(r *Record) {
+	a.events++
+
+	keys := make([]any, len(a.agg.GroupBy))
+	var id strings.Builder
+	for i, f := range a.agg.GroupBy {
+		v, _ := r.Get(f)
+		keys[i] = v
+		id.WriteString(toString(v))
+		id.WriteByte(0)
+	}
+
+	g, ok := a.groups[id.String()]
+	if !ok {
+		g = &group{
+			keys:    keys,
+			sums:    make(map[string]float64),
+			samples: make(map[string]int),
+			mins:    make(map[string]any),
+			maxs:    make(map[string]any),
+		}
+		a.groups[id.String()] = g
+		a.order = append(a.order, id.String())
+	}
+	g.count++
+
+	for _, m := range a.metrics {
+		v, ok := r.Get(m.field)
+		if !ok || v == nil {
+			continue
+		}
+		switch m.fn {
+		case "sum", "avg":
+			// sum and avg of the same field are kept apart, so they're tracked by column
+			if f, ok := toFloat(v); ok {
+				g.sums[m.column] += f
+				g.samples[m.column]++
+			}
+		case "min":
+			if cur, ok := g.mins[m.field]; !ok || compare(v, cur) < 0 {
+				g.mins[m.field] = v
+			}
+		case "max":
+			if cur, ok := g.maxs[m.field]; !ok || compare(v, cur) > 0 {
+				g.maxs[m.field] = v
+			}
+		}
+	}
+}
+
+// Events returns the number of records added so far.
+func (a *Aggregator) Events() int {
+	return a.events
+}
+
+// Groups returns the number of distinct groups.
+func (a *Aggregator) Groups() int {
+	return len(a.groups)
+}
+
+// Rows returns one record per group, sorted by the order_by column in the requested
+// order and limited to top entries. Groups with equal values keep the order they
+// were first seen in.
+func (a *Aggregator) Rows() []*Record {
+	rows := make([]*Record, 0, len(a.groups))
+	for _, id := range a.order {
+		g := a.groups[id]
+		row := NewRecord()
+		for i, f := range a.agg.GroupBy {
+			row.Set(f, g.keys[i])
+		}
+		row.Set(countColumn, g.count)
+		for _, m := range a.metrics {
+			switch m.fn {
+			case "sum":
+				row.Set(m.column, g.sums[m.column])
+			case "avg":
+				if n := g.samples[m.column]; n > 0 {
+					row.Set(m.column, g.sums[m.column]/float64(n))
+				} else {
+					row.Set(m.column, nil)
+				}
+			case "min":
+				row.Set(m.column, g.mins[m.field])
+			case "max":
+				row.Set(m.column, g.maxs[m.field])
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	orderBy := a.agg.OrderBy
+	if orderBy == "" {
+		orderBy = countColumn
+	}
+	direction := 1
+	if a.agg.Order == orderAsc {
+		direction = -1
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		vi, _ := rows[i].Get(orderBy)
+		vj, _ := rows[j].Get(orderBy)
+		return direction*compare(vi, vj) > 0
+	})
+
+	if a.agg.Top > 0 && len(rows) > a.agg.Top {
+		rows = rows[:a.agg.Top]
+	}
+	return rows
+}
+
+// compare compares two field values numerically if possible and as strings otherwise.
+func compare(a, b any) int {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(toString(a), toString(b))
+}
@@ -0,0 +1,148 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAggregationValidate(t *testing.T) {
+	fields := []string{"k8s", "k8s.namespace", "k8s.podName", "k8s.owner", "k8s.owner.name", "proc.comm", "size"}
+	tests := []struct {
+		name string
+		agg  Aggregation
+		want string
+	}{
+		{name: "leaf fields", agg: Aggregation{GroupBy: []string{"k8s.namespace", "proc.comm"}, Sum: []string{"size"}}},
+		{
+			name: "parent field",
+			agg:  Aggregation{GroupBy: []string{"k8s"}},
+			want: `field "k8s" in group_by is a parent field, use its leaf fields instead: k8s.namespace, k8s.podName, k8s.owner.name`,
+		},
+		{
+			name: "unknown field",
+			agg:  Aggregation{GroupBy: []string{"proc.pid"}},
+			want: `unknown field "proc.pid" in group_by, must be one of: k8s.namespace, k8s.podName, k8s.owner.name, proc.comm, size`,
+		},
+		{name: "no group", agg: Aggregation{Sum: []string{"size"}}, want: "group_by must contain at least one field"},
+		{name: "order by", agg: Aggregation{GroupBy: []string{"proc.comm"}, OrderBy: "sum(size)"}, want: `invalid order_by "sum(size)"`},
+		{name: "order", agg: Aggregation{GroupBy: []string{"proc.comm"}, Order: "up"}, want: `invalid order "up", must be asc or desc`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.agg.Validate(fields)
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func aggregate(t *testing.T, agg Aggregation) *Aggregator {
+	t.Helper()
+	events := []string{
+		`{"pod":"a","size":10,"lat":5}`,
+		`{"pod":"b","size":1,"lat":9}`,
+		`{"pod":"a","size":20,"lat":1}`,
+		// records lacking the metric or the group field
+		`{"pod":"c","size":4}`,
+		`{"size":7}`,
+		`{"pod":"b","size":3,"lat":2}`,
+	}
+	a := NewAggregator(agg)
+	for _, ev := range events {
+		r, err := ParseRecord([]byte(ev))
+		if err != nil {
+			t.Fatalf("parsing event: %v", err)
+		}
+		a.Add(r)
+	}
+	return a
+}
+
+func TestAggregatorRows(t *testing.T) {
+	a := aggregate(t, Aggregation{
+		GroupBy: []string{"pod"},
+		Sum:     []string{"size"},
+		Min:     []string{"lat"},
+		Max:     []string{"lat"},
+		Avg:     []string{"size", "lat"},
+	})
+	want := []string{
+		`{"pod":"a","count":2,"sum(size)":30,"min(lat)":1,"max(lat)":5,"avg(size)":15,"avg(lat)":3}`,
+		`{"pod":"b","count":2,"sum(size)":4,"min(lat)":2,"max(lat)":9,"avg(size)":2,"avg(lat)":5.5}`,
+		`{"pod":"c","count":1,"sum(size)":4,"min(lat)":null,"max(lat)":null,"avg(size)":4,"avg(lat)":null}`,
+		`{"pod":null,"count":1,"sum(size)":7,"min(lat)":null,"max(lat)":null,"avg(size)":7,"avg(lat)":null}`,
+	}
+	rows := a.Rows()
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d rows, got %d", len(want), len(rows))
+	}
+	for i, row := range rows {
+		got, err := row.MarshalJSON()
+		if err != nil {
+			t.Fatalf("encoding row: %v", err)
+		}
+		if string(got) != want[i] {
+			t.Errorf("row %d:\ngot  %s\nwant %s", i, got, want[i])
+		}
+	}
+	if a.Events() != 6 || a.Groups() != 4 {
+		t.Errorf("expected 6 events in 4 groups, got %d in %d", a.Events(), a.Groups())
+	}
+}
+
+func TestAggregatorOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		agg  Aggregation
+		want string
+	}{
+		// groups with the same value keep the order they were first seen in
+		{name: "count", want: "a b c <nil>"},
+		{name: "count ascending", agg: Aggregation{Order: "asc"}, want: "c <nil> a b"},
+		{name: "sum", agg: Aggregation{OrderBy: "sum(size)", Order: "desc"}, want: "a <nil> b c"},
+		{name: "sum ascending", agg: Aggregation{OrderBy: "sum(size)", Order: "asc"}, want: "b c <nil> a"},
+		// missing values sort below all others
+		{name: "max", agg: Aggregation{OrderBy: "max(lat)"}, want: "b a c <nil>"},
+		{name: "max ascending", agg: Aggregation{OrderBy: "max(lat)", Order: "asc"}, want: "c <nil> a b"},
+		{name: "top", agg: Aggregation{Top: 2}, want: "a b"},
+		{name: "top ascending", agg: Aggregation{OrderBy: "sum(size)", Order: "asc", Top: 1}, want: "b"},
+		{name: "top above groups", agg: Aggregation{Top: 10}, want: "a b c <nil>"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.agg.GroupBy = []string{"pod"}
+			tc.agg.Sum = []string{"size"}
+			tc.agg.Max = []string{"lat"}
+			var pods []string
+			for _, row := range aggregate(t, tc.agg).Rows() {
+				v, _ := row.Get("pod")
+				pods = append(pods, fmt.Sprint(v))
+			}
+			if got := strings.Join(pods, " "); got != tc.want {
+				t.Errorf("expected groups %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	firstSeenColumn = "first_seen"
+	lastSeenColumn  = "last_seen"
+)
+
+// Dedupe describes how duplicate records are merged.
+type Dedupe struct {
+	// Key lists the fields records are compared on, all fields except timestamps if empty
+	Key []string `json:"key,omitempty"`
+	// Timestamps lists the fields holding the time of an event, as told by the metadata
+	// of the gadget. They're left out of the default key and give the time records were
+	// first and last seen.
+	Timestamps []string `json:"-"`
+}
+
+// Validate checks that the key only uses the given fields.
+func (d Dedupe) Validate(fields []string) error {
+	for _, f := range d.Key {
+		if !slices.Contains(fields, f) {
+			return fmt.Errorf("unknown field %q in key", f)
+		}
+	}
+	return nil
+}
+
+// Fields returns the fields that need to be present in the records.
+func (d Dedupe) Fields() []string {
+	return d.Key
+}
+
+type duplicate struct {
+	record    *Record
+	count     int
+	firstSeen any
+	lastSeen  any
+}
+
+// Deduper merges records that are equal on the key of a Dedupe into one record
+// with the number of occurrences and the time they were first and last seen.
+type Deduper struct {
+	dedupe  Dedupe
+	events  int
+	records map[string]*duplicate
+	order   []string
+}
+
+func NewDeduper(dedupe Dedupe) *Deduper {
+	return &Deduper{
+		dedupe:  dedupe,
+		records: make(map[string]*duplicate),
+	}
+}
+
+// Add adds a record, merging it with an equal one added before.
+func (d *Deduper) Add(r *Record) {
+	d.events++
+
+	var key []string
+	if len(d.dedupe.Key) > 0 {
+		key = d.dedupe.Key
+	} else {
+		for _, k := range r.Keys {
+			if !slices.Contains(d.dedupe.Timestamps, k) {
+				key = append(key, k)
+			}
+		}
+	}
+
+	var id strings.Builder
+	for _, k := range key {
+		v, _ := r.Get(k)
+		id.WriteString(k)
+		id.WriteByte(0)
+		id.WriteString(toString(v))
+		id.WriteByte(0)
+	}
+
+	seen := eventTime(r, d.dedupe.Timestamps)
+	dup, ok := d.records[id.String()]
+	if !ok {
+		rec := NewRecord()
+		for _, k := range key {
+			v, _ := r.Get(k)
+			rec.Set(k, v)
+		}
+		dup = &duplicate{record: rec, firstSeen: seen}
+		d.records[id.String()] = dup
+		d.order = append(d.order, id.String())
+	}
+	dup.count++
+	dup.lastSeen = seen
+}
+
+// eventTime returns the first of the timestamps of a record, formatted the way the
+// gadget formats them, or the current time if it has none.
+func eventTime(r *Record, timestamps []string) any {
+	for _, k := range timestamps {
+		v, ok := r.Get(k)
+		if !ok {
+			continue
+		}
+		if s, ok := v.(string); ok && s != "" {
+			return s
+		}
+		if ts, ok := timestampValue(v); ok {
+			return ts.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// timestampValue parses a timestamp, either formatted as RFC 3339 or as the number of
+// nanoseconds since the epoch like raw gadget timestamps.
+func timestampValue(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case string:
+		ts, err := time.Parse(time.RFC3339Nano, v)
+		return ts, err == nil
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(0, n), err == nil && n > 0
+	case float64:
+		return time.Unix(0, int64(v)), v > 0
+	}
+	return time.Time{}, false
+}
+
+// Events returns the number of records added.
+func (d *Deduper) Events() int {
+	return d.events
+}
+
+// Records returns the merged records in the order they were first seen.
+func (d *Deduper) Records() []*Record {
+	records := make([]*Record, 0, len(d.order))
+	for _, id := range d.order {
+		dup := d.records[id]
+		rec := NewRecord()
+		for _, k := range dup.record.Keys {
+			rec.Set(k, dup.record.Values[k])
+		}
+		rec.Set(countColumn, dup.count)
+		rec.Set(firstSeenColumn, dup.firstSeen)
+		rec.Set(lastSeenColumn, dup.lastSeen)
+		records = append(records, rec)
+	}
+	return records
+}
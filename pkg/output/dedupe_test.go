@@ -0,0 +1,75 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDeduper(t *testing.T) {
+	events := []string{
+		`{"ts":1735689601000000000,"comm":"curl","timestamps_seen":1}`,
+		`{"ts":1735689602000000000,"comm":"curl","timestamps_seen":1}`,
+		`{"ts":1735689603000000000,"comm":"curl","timestamps_seen":2}`,
+	}
+	tests := []struct {
+		name   string
+		dedupe Dedupe
+		want   []string
+	}{
+		{
+			// only the fields the gadget tags as timestamps are left out of the default key
+			name:   "default key",
+			dedupe: Dedupe{Timestamps: []string{"ts"}},
+			want: []string{
+				`{"comm":"curl","timestamps_seen":1,"count":2,"first_seen":"2025-01-01T00:00:01Z","last_seen":"2025-01-01T00:00:02Z"}`,
+				`{"comm":"curl","timestamps_seen":2,"count":1,"first_seen":"2025-01-01T00:00:03Z","last_seen":"2025-01-01T00:00:03Z"}`,
+			},
+		},
+		{
+			name:   "key",
+			dedupe: Dedupe{Key: []string{"comm"}, Timestamps: []string{"ts"}},
+			want: []string{
+				`{"comm":"curl","count":3,"first_seen":"2025-01-01T00:00:01Z","last_seen":"2025-01-01T00:00:03Z"}`,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewDeduper(tc.dedupe)
+			for _, ev := range events {
+				r, err := ParseRecord([]byte(ev))
+				if err != nil {
+					t.Fatalf("parsing event: %v", err)
+				}
+				d.Add(r)
+			}
+			records := d.Records()
+			if len(records) != len(tc.want) {
+				t.Fatalf("expected %d records, got %d", len(tc.want), len(records))
+			}
+			for i, r := range records {
+				buf, err := json.Marshal(r)
+				if err != nil {
+					t.Fatalf("encoding record: %v", err)
+				}
+				if string(buf) != tc.want[i] {
+					t.Errorf("expected record %s, got %s", tc.want[i], buf)
+				}
+			}
+		})
+	}
+}
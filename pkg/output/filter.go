@@ -0,0 +1,157 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Filter matches records using the syntax of the filter operator of Inspektor
+// Gadget: a comma-separated list of conditions like field==value that all have
+// to be true. Supported operators are ==, !=, <, <=, >, >=, ~ and !~ (regex).
+type Filter struct {
+	conds []condition
+}
+
+type condition struct {
+	field  string
+	op     string
+	negate bool
+	value  string
+	re     *regexp.Regexp
+}
+
+// ParseFilter parses a filter expression.
+func ParseFilter(expr string) (*Filter, error) {
+	f := &Filter{}
+	for _, c := range splitEscaped(expr, ',') {
+		if c == "" {
+			continue
+		}
+		cond, err := parseCondition(c)
+		if err != nil {
+			return nil, err
+		}
+		f.conds = append(f.conds, cond)
+	}
+	if len(f.conds) == 0 {
+		return nil, fmt.Errorf("empty filter expression")
+	}
+	return f, nil
+}
+
+// operators holds the supported operators, longer ones first so that a value
+// starting with an operator character isn't taken as part of the operator.
+var operators = []string{"==", "!=", "<=", ">=", "!~", "=", "<", ">", "~"}
+
+func parseCondition(c string) (condition, error) {
+	i := strings.IndexAny(c, "!~<>=")
+	if i <= 0 {
+		return condition{}, fmt.Errorf("invalid condition %q, expected field, operator and value like comm==curl", c)
+	}
+	op := c[i : i+1]
+	for _, o := range operators {
+		if strings.HasPrefix(c[i:], o) {
+			op = o
+			break
+		}
+	}
+	cond := condition{field: strings.TrimSpace(c[:i]), value: c[i+len(op):]}
+	switch op {
+	case "=", "==":
+		cond.op = "=="
+	case "!=":
+		cond.op = "=="
+		cond.negate = true
+	case "<", "<=", ">", ">=":
+		cond.op = op
+	case "~", "!~":
+		re, err := regexp.Compile(cond.value)
+		if err != nil {
+			return condition{}, fmt.Errorf("invalid regular expression in condition %q: %w", c, err)
+		}
+		cond.op = "~"
+		cond.negate = op == "!~"
+		cond.re = re
+	default:
+		return condition{}, fmt.Errorf("invalid operator %q in condition %q", op, c)
+	}
+	return cond, nil
+}
+
+// splitEscaped splits s at sep unless it's escaped using a backslash.
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == sep {
+			cur.WriteByte(sep)
+			i++
+			continue
+		}
+		if s[i] == sep {
+			parts = append(parts, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteByte(s[i])
+	}
+	return append(parts, cur.String())
+}
+
+// Fields returns the fields used by the filter.
+func (f *Filter) Fields() []string {
+	fields := make([]string, 0, len(f.conds))
+	for _, c := range f.conds {
+		fields = append(fields, c.field)
+	}
+	return fields
+}
+
+// Match returns true if the record fulfills all conditions.
+func (f *Filter) Match(r *Record) bool {
+	for _, c := range f.conds {
+		v, ok := r.Get(c.field)
+		if !ok {
+			return false
+		}
+		if c.match(v) == c.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condition) match(v any) bool {
+	if c.op == "~" {
+		return c.re.MatchString(toString(v))
+	}
+	cmp := compare(v, c.value)
+	switch c.op {
+	case "==":
+		return cmp == 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
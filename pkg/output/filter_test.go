@@ -0,0 +1,134 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr        string
+		field       string
+		op          string
+		negate      bool
+		value       string
+		expectedErr string
+	}{
+		{expr: "comm=curl", field: "comm", op: "==", value: "curl"},
+		{expr: "comm==curl", field: "comm", op: "==", value: "curl"},
+		{expr: "comm!=curl", field: "comm", op: "==", negate: true, value: "curl"},
+		{expr: "pid<10", field: "pid", op: "<", value: "10"},
+		{expr: "pid<=10", field: "pid", op: "<=", value: "10"},
+		{expr: "pid>10", field: "pid", op: ">", value: "10"},
+		{expr: "pid>=10", field: "pid", op: ">=", value: "10"},
+		{expr: "comm~^cu", field: "comm", op: "~", value: "^cu"},
+		{expr: "comm!~^cu", field: "comm", op: "~", negate: true, value: "^cu"},
+		{expr: " proc.comm ==curl", field: "proc.comm", op: "==", value: "curl"},
+		// values may start with operator characters
+		{expr: "comm==~x", field: "comm", op: "==", value: "~x"},
+		{expr: "path~=^/", field: "path", op: "~", value: "=^/"},
+		{expr: "comm!==x", field: "comm", op: "==", negate: true, value: "=x"},
+		{expr: "comm", expectedErr: "expected field, operator and value"},
+		{expr: "==curl", expectedErr: "expected field, operator and value"},
+		{expr: "comm!curl", expectedErr: `invalid operator "!"`},
+		{expr: "comm~(", expectedErr: "invalid regular expression"},
+		{expr: ",", expectedErr: "empty filter expression"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			f, err := ParseFilter(tc.expr)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(f.conds) != 1 {
+				t.Fatalf("expected 1 condition, got %d", len(f.conds))
+			}
+			c := f.conds[0]
+			if c.field != tc.field || c.op != tc.op || c.negate != tc.negate || c.value != tc.value {
+				t.Errorf("expected %s %s %s (negate %v), got %s %s %s (negate %v)",
+					tc.field, tc.op, tc.value, tc.negate, c.field, c.op, c.value, c.negate)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	rec, err := ParseRecord([]byte(`{"proc":{"comm":"curl","pid":42},"path":"/etc/passwd","error":0}`))
+	if err != nil {
+		t.Fatalf("parsing record: %v", err)
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "proc.comm==curl", want: true},
+		{expr: "proc.comm==wget", want: false},
+		{expr: "proc.comm!=wget", want: true},
+		{expr: "proc.comm!=curl", want: false},
+		// numbers are compared by value
+		{expr: "proc.pid==42.0", want: true},
+		{expr: "proc.pid>9", want: true},
+		{expr: "proc.pid<9", want: false},
+		{expr: "proc.pid>=42", want: true},
+		{expr: "proc.pid<=41", want: false},
+		// non numeric values are compared as strings
+		{expr: "proc.comm<d", want: true},
+		{expr: "proc.comm>9", want: true},
+		{expr: "proc.pid>abc", want: false},
+		{expr: "path~^/etc/", want: true},
+		{expr: "path!~^/etc/", want: false},
+		{expr: "path~=^/", want: false},
+		// all conditions have to match
+		{expr: "proc.comm==curl,error==0", want: true},
+		{expr: "proc.comm==curl,error!=0", want: false},
+		// missing fields never match, not even negated conditions
+		{expr: "missing==", want: false},
+		{expr: "missing!=curl", want: false},
+		{expr: "proc==curl", want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			f, err := ParseFilter(tc.expr)
+			if err != nil {
+				t.Fatalf("parsing filter: %v", err)
+			}
+			if got := f.Match(rec); got != tc.want {
+				t.Errorf("expected match %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFilterFields(t *testing.T) {
+	f, err := ParseFilter(`proc.comm==curl,path~a\,b`)
+	if err != nil {
+		t.Fatalf("parsing filter: %v", err)
+	}
+	if fields := f.Fields(); !slices.Equal(fields, []string{"proc.comm", "path"}) {
+		t.Errorf("expected the fields of both conditions, got %v", fields)
+	}
+	if re := f.conds[1].re.String(); re != "a,b" {
+		t.Errorf("expected the escaped separator to be part of the value, got %q", re)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format is the encoding used for gadget results.
+type Format string
+
+const (
+	// FormatJSONL encodes each record as a JSON object on its own line
+	FormatJSONL Format = "jsonl"
+	// FormatCSV encodes records as comma-separated values with a single header row
+	FormatCSV Format = "csv"
+	// FormatTable encodes records as an aligned text table
+	FormatTable Format = "table"
+)
+
+// Formats lists all supported formats.
+var Formats = []string{string(FormatJSONL), string(FormatCSV), string(FormatTable)}
+
+// ParseFormat validates the given format name, an empty name results in FormatJSONL.
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return FormatJSONL, nil
+	}
+	if !slices.Contains(Formats, name) {
+		return "", fmt.Errorf("unsupported output format %q, must be one of: %s", name, strings.Join(Formats, ", "))
+	}
+	return Format(name), nil
+}
+
+// Encode renders records in the given format. It returns an optional header and
+// one entry per record so callers can cut the output at record boundaries.
+func Encode(format Format, records []*Record) (string, []string, error) {
+	switch format {
+	case FormatCSV:
+		return encodeCSV(records)
+	case FormatTable:
+		header, rows := encodeTable(records)
+		return header, rows, nil
+	}
+	rows := make([]string, 0, len(records))
+	for _, r := range records {
+		buf, err := r.MarshalJSON()
+		if err != nil {
+			return "", nil, fmt.Errorf("encoding record: %w", err)
+		}
+		rows = append(rows, string(buf))
+	}
+	return "", rows, nil
+}
+
+// columns returns the union of the fields of all records in order of appearance.
+func columns(records []*Record) []string {
+	var cols []string
+	seen := make(map[string]struct{})
+	for _, r := range records {
+		for _, k := range r.Keys {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			cols = append(cols, k)
+		}
+	}
+	return cols
+}
+
+func encodeCSV(records []*Record) (string, []string, error) {
+	cols := columns(records)
+	line := func(values []string) (string, error) {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write(values); err != nil {
+			return "", err
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+
+	header, err := line(cols)
+	if err != nil {
+		return "", nil, fmt.Errorf("encoding csv header: %w", err)
+	}
+	rows := make([]string, 0, len(records))
+	values := make([]string, len(cols))
+	for _, r := range records {
+		for i, c := range cols {
+			v, _ := r.Get(c)
+			values[i] = toString(v)
+		}
+		row, err := line(values)
+		if err != nil {
+			return "", nil, fmt.Errorf("encoding csv row: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, nil
+}
+
+func encodeTable(records []*Record) (string, []string) {
+	cols := columns(records)
+	widths := make([]int, len(cols))
+	for i, c := range cols {
+		widths[i] = utf8.RuneCountInString(c)
+	}
+	cells := make([][]string, 0, len(records))
+	for _, r := range records {
+		row := make([]string, len(cols))
+		for i, c := range cols {
+			v, _ := r.Get(c)
+			// keep every record on a single line
+			row[i] = strings.NewReplacer("\n", `\n`, "\t", `\t`).Replace(toString(v))
+			widths[i] = max(widths[i], utf8.RuneCountInString(row[i]))
+		}
+		cells = append(cells, row)
+	}
+
+	line := func(values []string) string {
+		var sb strings.Builder
+		for i, v := range values {
+			if i > 0 {
+				sb.WriteString("  ")
+			}
+			sb.WriteString(v)
+			if i < len(values)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v)))
+			}
+		}
+		return sb.String()
+	}
+
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = strings.ToUpper(c)
+	}
+	rows := make([]string, 0, len(cells))
+	for _, row := range cells {
+		rows = append(rows, line(row))
+	}
+	return line(header), rows
+}
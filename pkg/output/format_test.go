@@ -0,0 +1,105 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		events []string
+		header string
+		rows   []string
+	}{
+		{
+			name:   "jsonl",
+			format: FormatJSONL,
+			events: []string{`{"proc":{"comm":"curl","pid":1}}`, `{"proc":{"comm":"sh","pid":2}}`},
+			rows:   []string{`{"proc.comm":"curl","proc.pid":1}`, `{"proc.comm":"sh","proc.pid":2}`},
+		},
+		{
+			name:   "csv",
+			format: FormatCSV,
+			events: []string{`{"comm":"curl","pid":1}`, `{"comm":"sh","pid":2}`},
+			header: "comm,pid",
+			rows:   []string{"curl,1", "sh,2"},
+		},
+		{
+			name:   "csv quoting",
+			format: FormatCSV,
+			events: []string{`{"args":"a,b","msg":"say \"hi\"","out":"line1\nline2"}`},
+			header: "args,msg,out",
+			rows:   []string{`"a,b","say ""hi""","line1` + "\n" + `line2"`},
+		},
+		{
+			name:   "csv columns of all records",
+			format: FormatCSV,
+			events: []string{`{"comm":"curl"}`, `{"pid":2,"comm":"sh"}`, `{"error":1}`},
+			header: "comm,pid,error",
+			rows:   []string{"curl,,", "sh,2,", ",,1"},
+		},
+		{
+			name:   "table",
+			format: FormatTable,
+			events: []string{`{"proc":{"comm":"curl","pid":1}}`, `{"proc":{"comm":"containerd","pid":1234}}`},
+			header: "PROC.COMM   PROC.PID",
+			rows: []string{
+				"curl        1",
+				"containerd  1234",
+			},
+		},
+		{
+			name:   "table columns of all records",
+			format: FormatTable,
+			events: []string{`{"b":"x"}`, `{"a":"yy","b":"z"}`, `{"c":"line1\nline2"}`},
+			header: "B  A   C",
+			// only the last column isn't padded
+			rows: []string{
+				"x      ",
+				"z  yy  ",
+				`       line1\nline2`,
+			},
+		},
+		{name: "jsonl empty", format: FormatJSONL},
+		{name: "csv empty", format: FormatCSV},
+		{name: "table empty", format: FormatTable},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var records []*Record
+			for _, ev := range tc.events {
+				r, err := ParseRecord([]byte(ev))
+				if err != nil {
+					t.Fatalf("parsing event: %v", err)
+				}
+				records = append(records, r)
+			}
+			header, rows, err := Encode(tc.format, records)
+			if err != nil {
+				t.Fatalf("encoding: %v", err)
+			}
+			if header != tc.header {
+				t.Errorf("expected header %q, got %q", tc.header, header)
+			}
+			if !slices.Equal(rows, tc.rows) && (len(rows) > 0 || len(tc.rows) > 0) {
+				t.Errorf("expected rows\n%q\ngot\n%q", tc.rows, rows)
+			}
+		})
+	}
+}
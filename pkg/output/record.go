@@ -0,0 +1,162 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Record is a single gadget event flattened to a list of fields. Nested objects
+// are flattened using dots, so keys match the full field names of the datasource
+// (e.g. k8s.podName).
+type Record struct {
+	Keys   []string
+	Values map[string]any
+}
+
+// NewRecord creates an empty record.
+func NewRecord() *Record {
+	return &Record{
+		Values: make(map[string]any),
+	}
+}
+
+// ParseRecord parses a JSON encoded event into a flattened record.
+func ParseRecord(buf []byte) (*Record, error) {
+	r := NewRecord()
+	if err := r.flatten("", buf); err != nil {
+		return nil, fmt.Errorf("parsing record: %w", err)
+	}
+	return r, nil
+}
+
+// Set sets the value of a field, appending it if it does not exist yet.
+func (r *Record) Set(key string, value any) {
+	if _, ok := r.Values[key]; !ok {
+		r.Keys = append(r.Keys, key)
+	}
+	r.Values[key] = value
+}
+
+// Get returns the value of a field.
+func (r *Record) Get(key string) (any, bool) {
+	v, ok := r.Values[key]
+	return v, ok
+}
+
+// MarshalJSON encodes the record as a flat JSON object keeping the order of its fields.
+func (r *Record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range r.Keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(r.Values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (r *Record) flatten(prefix string, buf []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return fmt.Errorf("expected object, got %v", tok)
+	}
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("expected key, got %v", tok)
+		}
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return err
+		}
+		if len(raw) > 0 && raw[0] == '{' {
+			if err = r.flatten(prefix+key+".", raw); err != nil {
+				return err
+			}
+			continue
+		}
+		var val any
+		vdec := json.NewDecoder(bytes.NewReader(raw))
+		vdec.UseNumber()
+		if err = vdec.Decode(&val); err != nil {
+			return err
+		}
+		r.Set(prefix+key, val)
+	}
+	return nil
+}
+
+// toFloat converts a field value to a float64 if it is numeric.
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toString converts a field value to its string representation.
+func toString(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case json.Number:
+		return s.String()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,192 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bytesPerToken is used to estimate the number of tokens of a result
+const bytesPerToken = 4
+
+// DefaultBudget is the budget used if none is configured.
+var DefaultBudget = Budget{Size: 64 * 1024}
+
+// Budget limits the size of a result, either in bytes or in estimated tokens.
+type Budget struct {
+	Size   int
+	Tokens bool
+}
+
+// ParseBudget parses a budget like 65536, 64kb or 16000tokens.
+func ParseBudget(value string) (Budget, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	b := Budget{}
+	mult := 1
+	switch {
+	case strings.HasSuffix(v, "tokens"):
+		v = strings.TrimSuffix(v, "tokens")
+		b.Tokens = true
+	case strings.HasSuffix(v, "kb"):
+		v = strings.TrimSuffix(v, "kb")
+		mult = 1024
+	case strings.HasSuffix(v, "mb"):
+		v = strings.TrimSuffix(v, "mb")
+		mult = 1024 * 1024
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n <= 0 {
+		return Budget{}, fmt.Errorf("invalid budget %q, must be a positive number of bytes (e.g. 65536 or 64kb) or tokens (e.g. 16000tokens)", value)
+	}
+	b.Size = n * mult
+	return b, nil
+}
+
+func (b Budget) String() string {
+	if b.Tokens {
+		return fmt.Sprintf("%dtokens", b.Size)
+	}
+	if b.Size%1024 == 0 {
+		return fmt.Sprintf("%dkb", b.Size/1024)
+	}
+	return strconv.Itoa(b.Size)
+}
+
+// Bytes returns the budget in bytes, estimating the size of tokens budgets.
+func (b Budget) Bytes() int {
+	if b.Tokens {
+		return b.Size * bytesPerToken
+	}
+	return b.Size
+}
+
+// Shaped is a result that was fit into a budget.
+type Shaped struct {
+	// Rows holds the kept rows in their original order
+	Rows []string
+	// Omitted is the number of rows that were left out
+	Omitted int
+	// Reason explains why rows were left out
+	Reason string
+	// Sampling describes which rows were kept
+	Sampling string
+	// Truncated is set if not even the first row fit and only its start was kept
+	Truncated bool
+}
+
+// Shape keeps as many whole rows as fit into the budget next to the header. If
+// not all of them fit and sample is set, a representative sample of the head,
+// the tail and evenly spaced rows in between is kept, otherwise the first rows.
+// If not even the first row fits, its start is kept with a truncation marker.
+func Shape(header string, rows []string, budget Budget, sample bool) Shaped {
+	limit := budget.Bytes() - len(header) - 1
+	total := 0
+	for _, row := range rows {
+		total += len(row) + 1
+	}
+	if total <= limit {
+		return Shaped{Rows: rows}
+	}
+
+	reason := fmt.Sprintf("the %d records take about %s, more than the budget of %s", len(rows), size(total, budget), size(budget.Bytes(), budget))
+	keep := make([]bool, len(rows))
+	used := 0
+	add := func(i int) bool {
+		if used+len(rows[i])+1 > limit {
+			return false
+		}
+		keep[i] = true
+		used += len(rows[i]) + 1
+		return true
+	}
+
+	if len(rows[0])+1 > limit {
+		return truncated(rows, limit, reason)
+	}
+
+	if !sample {
+		kept := 0
+		for i := range rows {
+			if !add(i) {
+				break
+			}
+			kept++
+		}
+		return shaped(rows, keep, reason, fmt.Sprintf("first %d records", kept))
+	}
+
+	// the head gets 40% of the budget, the tail 20% and the rest is spread evenly in between
+	head := 0
+	for head < len(rows) && used+len(rows[head])+1 <= limit*4/10 && add(head) {
+		head++
+	}
+	tail := len(rows)
+	for tail > head && used+len(rows[tail-1])+1 <= limit*6/10 && add(tail-1) {
+		tail--
+	}
+	middle := 0
+	if n := tail - head; n > 0 {
+		avg := 0
+		for _, row := range rows[head:tail] {
+			avg += len(row) + 1
+		}
+		avg /= n
+		// at most one pick per row, so that the step doesn't go below 1
+		if count := min((limit-used)/max(avg, 1), n); count > 0 {
+			step := float64(n) / float64(count)
+			for j := 0; j < count; j++ {
+				if i := head + int(float64(j)*step); !keep[i] && add(i) {
+					middle++
+				}
+			}
+		}
+	}
+	return shaped(rows, keep, reason, fmt.Sprintf("first %d, %d evenly spaced in between and last %d records", head, middle, len(rows)-tail))
+}
+
+// truncated keeps the start of the first row, cut at a rune boundary.
+func truncated(rows []string, limit int, reason string) Shaped {
+	marker := fmt.Sprintf("...[truncated, %d bytes in total]", len(rows[0]))
+	row := rows[0][:max(0, min(len(rows[0]), limit-len(marker)-1))]
+	row = strings.ToValidUTF8(row, "")
+	return Shaped{
+		Rows:      []string{row + marker},
+		Omitted:   len(rows) - 1,
+		Reason:    reason,
+		Sampling:  "start of the first record",
+		Truncated: true,
+	}
+}
+
+func shaped(rows []string, keep []bool, reason, sampling string) Shaped {
+	res := Shaped{Reason: reason, Sampling: sampling}
+	for i, row := range rows {
+		if keep[i] {
+			res.Rows = append(res.Rows, row)
+		} else {
+			res.Omitted++
+		}
+	}
+	return res
+}
+
+func size(n int, budget Budget) string {
+	if budget.Tokens {
+		return fmt.Sprintf("%d tokens", (n+bytesPerToken-1)/bytesPerToken)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Budget
+		wantErr bool
+	}{
+		{value: "65536", want: Budget{Size: 65536}},
+		{value: "64kb", want: Budget{Size: 64 * 1024}},
+		{value: "1MB", want: Budget{Size: 1024 * 1024}},
+		{value: "16000tokens", want: Budget{Size: 16000, Tokens: true}},
+		{value: "0", wantErr: true},
+		{value: "-1kb", wantErr: true},
+		{value: "lots", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := ParseBudget(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+			if parsed, _ := ParseBudget(got.String()); parsed != got {
+				t.Errorf("expected %q to parse back to %v, got %v", got.String(), got, parsed)
+			}
+		})
+	}
+}
+
+func rows(n int) []string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("row-%04d", i)
+	}
+	return rows
+}
+
+func TestShapeFits(t *testing.T) {
+	in := rows(10)
+	got := Shape("header", in, Budget{Size: 1024}, true)
+	if got.Omitted != 0 || !slices.Equal(got.Rows, in) {
+		t.Errorf("expected all rows to be kept, got %+v", got)
+	}
+}
+
+func TestShape(t *testing.T) {
+	in := rows(100)
+	budget := Budget{Size: 50, Tokens: true}
+	for _, sample := range []bool{true, false} {
+		t.Run(fmt.Sprintf("sample=%v", sample), func(t *testing.T) {
+			got := Shape("header", in, budget, sample)
+			if got.Omitted == 0 || got.Omitted+len(got.Rows) != len(in) {
+				t.Fatalf("expected some of the %d rows to be omitted, got %d rows and %d omitted", len(in), len(got.Rows), got.Omitted)
+			}
+			if size := len("header") + len(strings.Join(got.Rows, "\n")) + 2; size > budget.Bytes() {
+				t.Errorf("expected the result to fit into %d bytes, got %d", budget.Bytes(), size)
+			}
+			if !slices.IsSorted(got.Rows) {
+				t.Errorf("expected the rows to keep their order, got %v", got.Rows)
+			}
+			if got.Rows[0] != in[0] {
+				t.Errorf("expected the first row to be kept, got %v", got.Rows)
+			}
+			if last := got.Rows[len(got.Rows)-1]; sample != (last == in[len(in)-1]) {
+				t.Errorf("expected the last row to be kept only when sampling, got %v", got.Rows)
+			}
+			if got.Reason == "" || got.Sampling == "" {
+				t.Errorf("expected the omission to be explained, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestShapeSampleOnce(t *testing.T) {
+	// the average size of the rows is rounded down, so more picks than rows seem to fit
+	in := []string{"a", "", "", "bb"}
+	got := Shape("", in, Budget{Size: 7}, true)
+	if got.Omitted+len(got.Rows) != len(in) {
+		t.Errorf("expected the kept and omitted rows to add up to %d, got %d rows and %d omitted", len(in), len(got.Rows), got.Omitted)
+	}
+	// a row picked twice would be counted twice
+	if want := fmt.Sprintf("first 1, %d evenly spaced in between and last 0 records", len(got.Rows)-1); got.Sampling != want {
+		t.Errorf("expected sampling %q, got %q", want, got.Sampling)
+	}
+}
+
+func TestShapeTruncated(t *testing.T) {
+	in := []string{strings.Repeat("x", 100) + "é", "row"}
+	for _, budget := range []int{50, 1} {
+		t.Run(fmt.Sprint(budget), func(t *testing.T) {
+			got := Shape("", in, Budget{Size: budget}, true)
+			if !got.Truncated || len(got.Rows) != 1 || got.Omitted != 1 {
+				t.Fatalf("expected the start of the first row to be kept, got %+v", got)
+			}
+			if !strings.HasPrefix(in[0], strings.TrimSuffix(got.Rows[0], "...[truncated, 102 bytes in total]")) || !strings.HasSuffix(got.Rows[0], "...[truncated, 102 bytes in total]") {
+				t.Errorf("expected the row to be cut with a marker, got %q", got.Rows[0])
+			}
+		})
+	}
+}
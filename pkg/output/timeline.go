@@ -0,0 +1,132 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Timeline merges the events of several gadgets into a single list ordered by time.
+// Once the kept events exceed the size limit, every other one is dropped and from then
+// on fewer of the added events are kept, so that they still cover the whole run.
+type Timeline struct {
+	mu     sync.Mutex
+	limit  int
+	size   int
+	added  int
+	stride int
+	events []timelineEvent
+}
+
+type timelineEvent struct {
+	seq    int
+	size   int
+	time   time.Time
+	record *Record
+}
+
+// NewTimeline creates an empty timeline keeping events of about limit bytes, or all
+// of them if limit is 0.
+func NewTimeline(limit int) *Timeline {
+	return &Timeline{limit: limit, stride: 1}
+}
+
+// Add adds an event tagged with its source as field sourceField. It's ordered by the
+// first of the given timestamp fields it has. It is safe to call from multiple goroutines.
+func (t *Timeline) Add(sourceField, source string, timestamps []string, buf []byte) error {
+	r, err := ParseRecord(buf)
+	if err != nil {
+		return err
+	}
+	rec := NewRecord()
+	rec.Set(sourceField, source)
+	for _, k := range r.Keys {
+		rec.Set(k, r.Values[k])
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seq := t.added
+	t.added++
+	if seq%t.stride != 0 {
+		return nil
+	}
+	ev := timelineEvent{seq: seq, size: len(buf) + len(sourceField) + len(source), time: recordTime(r, timestamps), record: rec}
+	t.events = append(t.events, ev)
+	t.size += ev.size
+	for t.limit > 0 && t.size > t.limit && len(t.events) > 1 {
+		t.thin()
+	}
+	return nil
+}
+
+// thin drops every other kept event.
+func (t *Timeline) thin() {
+	t.stride *= 2
+	t.size = 0
+	t.events = slices.DeleteFunc(t.events, func(ev timelineEvent) bool {
+		if ev.seq%t.stride != 0 {
+			return true
+		}
+		t.size += ev.size
+		return false
+	})
+}
+
+// Len returns the number of events added.
+func (t *Timeline) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.added
+}
+
+// Dropped returns the number of added events that were dropped to stay within the limit.
+func (t *Timeline) Dropped() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.added - len(t.events)
+}
+
+// Records returns the events ordered by their timestamp. Events without a timestamp
+// are placed at the time they were added.
+func (t *Timeline) Records() []*Record {
+	t.mu.Lock()
+	events := slices.Clone(t.events)
+	t.mu.Unlock()
+
+	slices.SortStableFunc(events, func(a, b timelineEvent) int {
+		return a.time.Compare(b.time)
+	})
+	records := make([]*Record, 0, len(events))
+	for _, ev := range events {
+		records = append(records, ev.record)
+	}
+	return records
+}
+
+// recordTime returns the time of the first of the timestamps of a record that can be
+// parsed, or the current time if it has none.
+func recordTime(r *Record, timestamps []string) time.Time {
+	for _, k := range timestamps {
+		if v, ok := r.Get(k); ok {
+			if ts, ok := timestampValue(v); ok {
+				return ts
+			}
+		}
+	}
+	return time.Now()
+}
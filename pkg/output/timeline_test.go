@@ -0,0 +1,59 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestTimeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		// want holds the numbers of the kept events in the order of their timestamps
+		want []string
+	}{
+		{name: "unlimited", want: []string{"9", "8", "7", "6", "5", "4", "3", "2", "1", "0"}},
+		// each event takes 49 bytes, so at most 3 are kept
+		{name: "limited", limit: 150, want: []string{"8", "4", "0"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			timeline := NewTimeline(tc.limit)
+			// add the events in reverse order of their timestamps
+			for i := 9; i >= 0; i-- {
+				ev := fmt.Sprintf(`{"n":%d,"timestamp":"2025-01-01T00:00:0%dZ"}`, 9-i, i)
+				if err := timeline.Add("gadget", "g", []string{"timestamp"}, []byte(ev)); err != nil {
+					t.Fatalf("adding event: %v", err)
+				}
+			}
+			if timeline.Len() != 10 {
+				t.Errorf("expected 10 events to be added, got %d", timeline.Len())
+			}
+			if dropped := timeline.Dropped(); dropped != 10-len(tc.want) {
+				t.Errorf("expected %d dropped events, got %d", 10-len(tc.want), dropped)
+			}
+			var got []string
+			for _, r := range timeline.Records() {
+				got = append(got, fmt.Sprint(r.Values["n"]))
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("expected events %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package packet decodes raw packets emitted by gadgets into a structured,
+// JSON serializable list of protocol layers.
+package packet
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+// LinkTypeAnnotation can be set on a raw packet field to the name (e.g. ethernet,
+// raw, linux_sll) or number of the link type of its packets, defaults to ethernet.
+const LinkTypeAnnotation = "packet.link-type"
+
+// Depth is the last layer packets are decoded up to.
+type Depth int
+
+const (
+	DepthNone Depth = iota
+	DepthLink
+	DepthNetwork
+	DepthTransport
+	DepthApplication
+)
+
+// Depths lists the names of all decode depths.
+var Depths = []string{"none", "link", "network", "transport", "application"}
+
+func (d Depth) String() string {
+	if d < 0 || int(d) >= len(Depths) {
+		return "unknown"
+	}
+	return Depths[d]
+}
+
+// ParseDepth returns the depth with the given name.
+func ParseDepth(name string) (Depth, error) {
+	for i, n := range Depths {
+		if strings.EqualFold(n, name) {
+			return Depth(i), nil
+		}
+	}
+	return DepthNone, fmt.Errorf("invalid decode depth %q, must be one of: %s", name, strings.Join(Depths, ", "))
+}
+
+var linkTypes = map[string]layers.LinkType{
+	"ethernet":   layers.LinkTypeEthernet,
+	"raw":        layers.LinkTypeRaw,
+	"ipv4":       layers.LinkTypeIPv4,
+	"ipv6":       layers.LinkTypeIPv6,
+	"linux_sll":  layers.LinkTypeLinuxSLL,
+	"loop":       layers.LinkTypeLoop,
+	"null":       layers.LinkTypeNull,
+	"ieee802_11": layers.LinkTypeIEEE802_11,
+}
+
+// ParseLinkType returns the link type with the given name or number, an empty
+// value returns ethernet.
+func ParseLinkType(value string) (layers.LinkType, error) {
+	if value == "" {
+		return layers.LinkTypeEthernet, nil
+	}
+	if lt, ok := linkTypes[strings.ToLower(value)]; ok {
+		return lt, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unknown link type %q", value)
+	}
+	return layers.LinkType(n), nil
+}
+
+type Ethernet struct {
+	Type      string `json:"type"`
+	Src       string `json:"src"`
+	Dst       string `json:"dst"`
+	EtherType string `json:"ether_type"`
+}
+
+type LinuxSLL struct {
+	Type     string `json:"type"`
+	Addr     string `json:"addr,omitempty"`
+	Protocol string `json:"protocol"`
+}
+
+type IPv4 struct {
+	Type     string `json:"type"`
+	Src      string `json:"src"`
+	Dst      string `json:"dst"`
+	Protocol string `json:"protocol"`
+	TTL      uint8  `json:"ttl"`
+	Length   uint16 `json:"length"`
+	ID       uint16 `json:"id"`
+	Flags    string `json:"flags,omitempty"`
+}
+
+type IPv6 struct {
+	Type       string `json:"type"`
+	Src        string `json:"src"`
+	Dst        string `json:"dst"`
+	NextHeader string `json:"next_header"`
+	HopLimit   uint8  `json:"hop_limit"`
+	Length     uint16 `json:"length"`
+}
+
+type TCP struct {
+	Type       string `json:"type"`
+	SrcPort    uint16 `json:"src_port"`
+	DstPort    uint16 `json:"dst_port"`
+	Seq        uint32 `json:"seq"`
+	Ack        uint32 `json:"ack"`
+	Flags      string `json:"flags"`
+	Window     uint16 `json:"window"`
+	PayloadLen int    `json:"payload_len"`
+}
+
+type UDP struct {
+	Type    string `json:"type"`
+	SrcPort uint16 `json:"src_port"`
+	DstPort uint16 `json:"dst_port"`
+	Length  uint16 `json:"length"`
+}
+
+type ICMP struct {
+	Type     string `json:"type"`
+	TypeCode string `json:"type_code"`
+}
+
+type DNSQuestion struct {
+	Name  string `json:"name"`
+	QType string `json:"qtype"`
+}
+
+type DNSRecord struct {
+	Name  string `json:"name"`
+	QType string `json:"qtype"`
+	TTL   uint32 `json:"ttl"`
+	Data  string `json:"data,omitempty"`
+}
+
+type DNS struct {
+	Type      string        `json:"type"`
+	ID        uint16        `json:"id"`
+	Response  bool          `json:"response"`
+	OpCode    string        `json:"opcode"`
+	RCode     string        `json:"rcode,omitempty"`
+	Questions []DNSQuestion `json:"questions,omitempty"`
+	Answers   []DNSRecord   `json:"answers,omitempty"`
+}
+
+type HTTP struct {
+	Type    string            `json:"type"`
+	Proto   string            `json:"proto"`
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Host    string            `json:"host,omitempty"`
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Other is a layer that is recognized but not decoded any further.
+type Other struct {
+	Type   string `json:"type"`
+	Length int    `json:"length"`
+}
+
+// Error reports the part of the packet that could not be decoded.
+type Error struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// httpHeaders are the headers included in decoded HTTP layers, others are left out to save space.
+var httpHeaders = []string{"Content-Type", "Content-Length", "User-Agent", "Location", "Server"}
+
+// Decode decodes data captured on a link of the given type up to depth, returning
+// one struct per layer with a type field naming the protocol.
+func Decode(data []byte, linkType layers.LinkType, depth Depth) []any {
+	if depth == DepthNone {
+		return nil
+	}
+	pkt := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+
+	var res []any
+	last := DepthNone
+	for _, l := range pkt.Layers() {
+		// the failure is in the layer following the last decoded one
+		if f, ok := l.(*gopacket.DecodeFailure); ok {
+			if min(last+1, DepthApplication) <= depth {
+				res = append(res, &Error{Type: "error", Error: f.Error().Error()})
+			}
+			break
+		}
+		level, decoded := decodeLayer(l)
+		if level > depth {
+			break
+		}
+		// layers that failed to decode are added without contents, the failure
+		// following them is reported in their place
+		if len(l.LayerContents()) == 0 {
+			continue
+		}
+		last = level
+		if decoded != nil {
+			res = append(res, decoded)
+		}
+		// gopacket doesn't know HTTP, try to parse TCP payloads as such
+		if tcp, ok := l.(*layers.TCP); ok && depth >= DepthApplication {
+			if h := decodeHTTP(tcp.Payload); h != nil {
+				res = append(res, h)
+			}
+		}
+	}
+	return res
+}
+
+func decodeLayer(l gopacket.Layer) (Depth, any) {
+	switch l := l.(type) {
+	case *layers.Ethernet:
+		return DepthLink, &Ethernet{
+			Type:      "ethernet",
+			Src:       l.SrcMAC.String(),
+			Dst:       l.DstMAC.String(),
+			EtherType: l.EthernetType.String(),
+		}
+	case *layers.LinuxSLL:
+		return DepthLink, &LinuxSLL{
+			Type:     "linux_sll",
+			Addr:     l.Addr.String(),
+			Protocol: l.EthernetType.String(),
+		}
+	case *layers.Dot1Q, *layers.Loopback:
+		return DepthLink, &Other{Type: strings.ToLower(l.LayerType().String()), Length: len(l.LayerContents())}
+	case *layers.IPv4:
+		return DepthNetwork, &IPv4{
+			Type:     "ipv4",
+			Src:      l.SrcIP.String(),
+			Dst:      l.DstIP.String(),
+			Protocol: l.Protocol.String(),
+			TTL:      l.TTL,
+			Length:   l.Length,
+			ID:       l.Id,
+			Flags:    ipv4Flags(l.Flags),
+		}
+	case *layers.IPv6:
+		return DepthNetwork, &IPv6{
+			Type:       "ipv6",
+			Src:        l.SrcIP.String(),
+			Dst:        l.DstIP.String(),
+			NextHeader: l.NextHeader.String(),
+			HopLimit:   l.HopLimit,
+			Length:     l.Length,
+		}
+	case *layers.ARP:
+		return DepthNetwork, &Other{Type: "arp", Length: len(l.LayerContents())}
+	case *layers.TCP:
+		return DepthTransport, &TCP{
+			Type:       "tcp",
+			SrcPort:    uint16(l.SrcPort),
+			DstPort:    uint16(l.DstPort),
+			Seq:        l.Seq,
+			Ack:        l.Ack,
+			Flags:      tcpFlags(l),
+			Window:     l.Window,
+			PayloadLen: len(l.Payload),
+		}
+	case *layers.UDP:
+		return DepthTransport, &UDP{
+			Type:    "udp",
+			SrcPort: uint16(l.SrcPort),
+			DstPort: uint16(l.DstPort),
+			Length:  l.Length,
+		}
+	case *layers.ICMPv4:
+		return DepthTransport, &ICMP{Type: "icmpv4", TypeCode: l.TypeCode.String()}
+	case *layers.ICMPv6:
+		return DepthTransport, &ICMP{Type: "icmpv6", TypeCode: l.TypeCode.String()}
+	case *layers.DNS:
+		return DepthApplication, decodeDNS(l)
+	case *gopacket.Payload:
+		return DepthApplication, nil
+	}
+	return DepthApplication, &Other{Type: strings.ToLower(l.LayerType().String()), Length: len(l.LayerContents())}
+}
+
+func decodeDNS(l *layers.DNS) *DNS {
+	dns := &DNS{
+		Type:     "dns",
+		ID:       l.ID,
+		Response: l.QR,
+		OpCode:   l.OpCode.String(),
+	}
+	if l.QR {
+		dns.RCode = l.ResponseCode.String()
+	}
+	for _, q := range l.Questions {
+		dns.Questions = append(dns.Questions, DNSQuestion{Name: string(q.Name), QType: q.Type.String()})
+	}
+	for _, rr := range l.Answers {
+		dns.Answers = append(dns.Answers, DNSRecord{
+			Name:  string(rr.Name),
+			QType: rr.Type.String(),
+			TTL:   rr.TTL,
+			Data:  dnsData(&rr),
+		})
+	}
+	return dns
+}
+
+func dnsData(rr *layers.DNSResourceRecord) string {
+	switch rr.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		return rr.IP.String()
+	case layers.DNSTypeNS:
+		return string(rr.NS)
+	case layers.DNSTypeCNAME:
+		return string(rr.CNAME)
+	case layers.DNSTypePTR:
+		return string(rr.PTR)
+	case layers.DNSTypeMX:
+		return fmt.Sprintf("%d %s", rr.MX.Preference, rr.MX.Name)
+	case layers.DNSTypeSRV:
+		return fmt.Sprintf("%d %d %d %s", rr.SRV.Priority, rr.SRV.Weight, rr.SRV.Port, rr.SRV.Name)
+	case layers.DNSTypeTXT:
+		return string(bytes.Join(rr.TXTs, []byte(" ")))
+	}
+	return ""
+}
+
+var httpMethods = []string{"GET ", "POST ", "PUT ", "DELETE ", "HEAD ", "OPTIONS ", "PATCH ", "CONNECT "}
+
+// decodeHTTP parses the start of an HTTP/1.x request or response, it returns nil
+// if the payload is not one.
+func decodeHTTP(payload []byte) *HTTP {
+	if len(payload) == 0 {
+		return nil
+	}
+	r := bufio.NewReader(bytes.NewReader(payload))
+	if bytes.HasPrefix(payload, []byte("HTTP/1.")) {
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil {
+			return nil
+		}
+		return &HTTP{
+			Type:    "http",
+			Proto:   resp.Proto,
+			Status:  resp.StatusCode,
+			Headers: pickHeaders(resp.Header),
+		}
+	}
+	for _, m := range httpMethods {
+		if !bytes.HasPrefix(payload, []byte(m)) {
+			continue
+		}
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return nil
+		}
+		return &HTTP{
+			Type:    "http",
+			Proto:   req.Proto,
+			Method:  req.Method,
+			URL:     req.RequestURI,
+			Host:    req.Host,
+			Headers: pickHeaders(req.Header),
+		}
+	}
+	return nil
+}
+
+func pickHeaders(h http.Header) map[string]string {
+	var res map[string]string
+	for _, name := range httpHeaders {
+		if v := h.Get(name); v != "" {
+			if res == nil {
+				res = make(map[string]string)
+			}
+			res[name] = v
+		}
+	}
+	return res
+}
+
+func tcpFlags(t *layers.TCP) string {
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{t.SYN, "SYN"}, {t.ACK, "ACK"}, {t.FIN, "FIN"}, {t.RST, "RST"},
+		{t.PSH, "PSH"}, {t.URG, "URG"}, {t.ECE, "ECE"}, {t.CWR, "CWR"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return strings.Join(flags, ",")
+}
+
+func ipv4Flags(f layers.IPv4Flag) string {
+	var flags []string
+	if f&layers.IPv4DontFragment != 0 {
+		flags = append(flags, "DF")
+	}
+	if f&layers.IPv4MoreFragments != 0 {
+		flags = append(flags, "MF")
+	}
+	return strings.Join(flags, ",")
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packet
+
+import (
+	"net"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+// serialize builds an ethernet frame carrying an IPv4 packet with the given transport
+// layer and payload.
+func serialize(t *testing.T, transport gopacket.SerializableLayer, payload []byte) []byte {
+	t.Helper()
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{6, 7, 8, 9, 10, 11},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		SrcIP:    net.IP{10, 0, 0, 1},
+		DstIP:    net.IP{10, 0, 0, 2},
+		Protocol: layers.IPProtocolTCP,
+	}
+	switch l := transport.(type) {
+	case *layers.TCP:
+		l.SetNetworkLayerForChecksum(ip)
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		l.SetNetworkLayerForChecksum(ip)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, transport, gopacket.Payload(payload)); err != nil {
+		t.Fatalf("serializing packet: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func dnsQuery(t *testing.T) []byte {
+	t.Helper()
+	dns := &layers.DNS{
+		ID:      42,
+		RD:      true,
+		QDCount: 1,
+		Questions: []layers.DNSQuestion{{
+			Name:  []byte("example.com"),
+			Type:  layers.DNSTypeA,
+			Class: layers.DNSClassIN,
+		}},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := dns.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		t.Fatalf("serializing DNS query: %v", err)
+	}
+	return serialize(t, &layers.UDP{SrcPort: 40000, DstPort: 53}, buf.Bytes())
+}
+
+func layerTypes(decoded []any) []string {
+	var types []string
+	for _, l := range decoded {
+		types = append(types, reflect.ValueOf(l).Elem().FieldByName("Type").String())
+	}
+	return types
+}
+
+func TestDecode(t *testing.T) {
+	httpRequest := serialize(t, &layers.TCP{SrcPort: 40000, DstPort: 80, PSH: true, ACK: true},
+		[]byte("GET /index.html HTTP/1.1\r\nHost: example.com\r\nUser-Agent: curl/8.0\r\nAccept: */*\r\n\r\n"))
+	httpResponse := serialize(t, &layers.TCP{SrcPort: 80, DstPort: 40000, PSH: true, ACK: true},
+		[]byte("HTTP/1.1 404 Not Found\r\nContent-Type: text/html\r\nContent-Length: 0\r\n\r\n"))
+	dns := dnsQuery(t)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		depth Depth
+		want  []string
+		// check inspects the last decoded layer
+		check func(t *testing.T, last any)
+	}{
+		{name: "none", data: dns, depth: DepthNone},
+		{name: "link", data: dns, depth: DepthLink, want: []string{"ethernet"}},
+		{name: "network", data: dns, depth: DepthNetwork, want: []string{"ethernet", "ipv4"}},
+		{name: "transport", data: dns, depth: DepthTransport, want: []string{"ethernet", "ipv4", "udp"}},
+		{
+			name:  "dns",
+			data:  dns,
+			depth: DepthApplication,
+			want:  []string{"ethernet", "ipv4", "udp", "dns"},
+			check: func(t *testing.T, last any) {
+				want := &DNS{Type: "dns", ID: 42, OpCode: "Query", Questions: []DNSQuestion{{Name: "example.com", QType: "A"}}}
+				if !reflect.DeepEqual(last, want) {
+					t.Errorf("expected %+v, got %+v", want, last)
+				}
+			},
+		},
+		{
+			name:  "http request",
+			data:  httpRequest,
+			depth: DepthApplication,
+			want:  []string{"ethernet", "ipv4", "tcp", "http"},
+			check: func(t *testing.T, last any) {
+				want := &HTTP{Type: "http", Proto: "HTTP/1.1", Method: "GET", URL: "/index.html", Host: "example.com", Headers: map[string]string{"User-Agent": "curl/8.0"}}
+				if !reflect.DeepEqual(last, want) {
+					t.Errorf("expected %+v, got %+v", want, last)
+				}
+			},
+		},
+		{
+			name:  "http response",
+			data:  httpResponse,
+			depth: DepthApplication,
+			want:  []string{"ethernet", "ipv4", "tcp", "http"},
+			check: func(t *testing.T, last any) {
+				want := &HTTP{Type: "http", Proto: "HTTP/1.1", Status: 404, Headers: map[string]string{"Content-Type": "text/html", "Content-Length": "0"}}
+				if !reflect.DeepEqual(last, want) {
+					t.Errorf("expected %+v, got %+v", want, last)
+				}
+			},
+		},
+		{name: "http below application", data: httpRequest, depth: DepthTransport, want: []string{"ethernet", "ipv4", "tcp"}},
+		{name: "not http", data: serialize(t, &layers.TCP{SrcPort: 40000, DstPort: 22, ACK: true}, []byte("SSH-2.0-OpenSSH_9.6\r\n")), depth: DepthApplication, want: []string{"ethernet", "ipv4", "tcp"}},
+		// the IPv4 header is cut in the middle
+		{name: "truncated", data: dns[:20], depth: DepthApplication, want: []string{"ethernet", "error"}},
+		{name: "truncated below depth", data: dns[:20], depth: DepthLink, want: []string{"ethernet"}},
+		// the DNS message is cut in the middle
+		{name: "truncated payload", data: dns[:45], depth: DepthApplication, want: []string{"ethernet", "ipv4", "udp", "error"}},
+		{name: "truncated payload below depth", data: dns[:45], depth: DepthTransport, want: []string{"ethernet", "ipv4", "udp"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			decoded := Decode(tc.data, layers.LinkTypeEthernet, tc.depth)
+			if got := layerTypes(decoded); !slices.Equal(got, tc.want) {
+				t.Fatalf("expected layers %v, got %v", tc.want, got)
+			}
+			if tc.check != nil {
+				tc.check(t, decoded[len(decoded)-1])
+			}
+		})
+	}
+}
+
+func TestParseLinkType(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    layers.LinkType
+		wantErr bool
+	}{
+		{value: "", want: layers.LinkTypeEthernet},
+		{value: "Linux_SLL", want: layers.LinkTypeLinuxSLL},
+		{value: "101", want: layers.LinkTypeRaw},
+		{value: "token_ring", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := ParseLinkType(tc.value)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error=%v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && got != tc.want {
+				t.Errorf("expected link type %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
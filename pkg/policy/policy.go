@@ -0,0 +1,256 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy restricts what clients can do with the tools of the server. A nil policy
+// allows everything.
+type Policy struct {
+	// Allow lists the tools, or actions of tools, that can be used. Everything can be
+	// used if it's empty.
+	Allow []string `yaml:"allow"`
+	// Deny lists the tools, or actions of tools, that can't be used, taking precedence over Allow.
+	Deny []string `yaml:"deny"`
+	// MaxDuration caps the duration gadgets can run for, there is no limit if it's 0
+	MaxDuration time.Duration `yaml:"maxDuration"`
+	// ForbidBackground forbids running gadgets in background (duration 0)
+	ForbidBackground bool `yaml:"forbidBackground"`
+	// Params restricts the params clients can set by tool name pattern. The values are
+	// patterns of the param keys that can be set, params of tools not matching any
+	// pattern aren't restricted.
+	Params map[string][]string `yaml:"params"`
+
+	allow []rule
+	deny  []rule
+}
+
+// rule matches the calls of tools, and optionally only some of their actions.
+type rule struct {
+	tool   string
+	action string
+}
+
+// Call is a tool call checked against a policy.
+type Call struct {
+	Tool string
+	// Action is the action of lifecycle tools
+	Action string
+	// Duration is the duration the call runs a gadget for, 0 running it in background.
+	// It's nil if the call doesn't run a gadget.
+	Duration *time.Duration
+	// Params holds the keys of the params set by the client
+	Params []string
+}
+
+// Violation is the error returned for calls that aren't allowed by a policy.
+type Violation struct {
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return "policy violation: " + v.Reason
+}
+
+func violation(format string, args ...any) error {
+	return &Violation{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Load reads a policy from a YAML file.
+func Load(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing policy %s: %w", file, err)
+	}
+	return p, nil
+}
+
+// Parse parses a YAML policy. Tools are given as glob patterns as supported by
+// path.Match, optionally followed by a pattern of their actions, e.g. "gadget_trace_*"
+// or "ig_deploy undeploy".
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if p.MaxDuration != 0 && p.MaxDuration < time.Second {
+		return nil, fmt.Errorf("invalid maxDuration %s: must be at least 1s", p.MaxDuration)
+	}
+
+	var err error
+	if p.allow, err = parseRules(p.Allow); err != nil {
+		return nil, fmt.Errorf("invalid allow entry: %w", err)
+	}
+	if p.deny, err = parseRules(p.Deny); err != nil {
+		return nil, fmt.Errorf("invalid deny entry: %w", err)
+	}
+	for tool, params := range p.Params {
+		for _, pattern := range append([]string{tool}, params...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid params pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+func parseRules(entries []string) ([]rule, error) {
+	rules := make([]rule, 0, len(entries))
+	for _, entry := range entries {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("%q must be a tool optionally followed by an action", entry)
+		}
+		r := rule{tool: fields[0]}
+		if len(fields) == 2 {
+			r.action = fields[1]
+		}
+		for _, pattern := range fields {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// matches returns true if the rule applies to the given action of a tool. Rules
+// without an action apply to all actions.
+func (r rule) matches(tool, action string) bool {
+	// patterns are validated when parsing the policy
+	if ok, _ := path.Match(r.tool, tool); !ok {
+		return false
+	}
+	if r.action == "" {
+		return true
+	}
+	ok, _ := path.Match(r.action, action)
+	return ok
+}
+
+// ToolAllowed returns false if the policy doesn't allow any call of the tool, so
+// that it isn't offered to clients.
+func (p *Policy) ToolAllowed(tool string) bool {
+	if p == nil {
+		return true
+	}
+	for _, r := range p.deny {
+		if r.action == "" && r.matches(tool, "") {
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, r := range p.allow {
+		// the tool is offered if at least one of its actions is allowed
+		if ok, _ := path.Match(r.tool, tool); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns a Violation if the policy doesn't allow the call.
+func (p *Policy) Check(call Call) error {
+	if p == nil {
+		return nil
+	}
+
+	name := call.Tool
+	if call.Action != "" {
+		name = fmt.Sprintf("action %s of tool %s", call.Action, call.Tool)
+	}
+	for _, r := range p.deny {
+		if r.matches(call.Tool, call.Action) {
+			return violation("%s is denied", name)
+		}
+	}
+	if len(p.allow) > 0 && !p.allowed(call.Tool, call.Action) {
+		return violation("%s is not allowed", name)
+	}
+
+	if call.Duration != nil {
+		d := *call.Duration
+		// gadgets running in background aren't bound by a duration
+		if d == 0 && (p.ForbidBackground || p.MaxDuration > 0) {
+			return violation("running gadgets in background (duration 0) is forbidden, set a duration of at least 1 second")
+		}
+		if p.MaxDuration > 0 && d > p.MaxDuration {
+			return violation("gadgets can run for at most %s, set a duration of at most %d seconds", p.MaxDuration, int(p.MaxDuration.Seconds()))
+		}
+	}
+
+	if allowed, ok := p.allowedParams(call.Tool); ok {
+		for _, key := range call.Params {
+			if !matchAny(allowed, key) {
+				return violation("param %s of %s can't be set, only these params can be: %s", key, call.Tool, strings.Join(allowed, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Policy) allowed(tool, action string) bool {
+	for _, r := range p.allow {
+		if r.matches(tool, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedParams returns the patterns of the params that can be set for a tool and
+// whether they are restricted at all.
+func (p *Policy) allowedParams(tool string) ([]string, bool) {
+	var allowed []string
+	restricted := false
+	for pattern, params := range p.Params {
+		if ok, _ := path.Match(pattern, tool); ok {
+			allowed = append(allowed, params...)
+			restricted = true
+		}
+	}
+	slices.Sort(allowed)
+	return allowed, restricted
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
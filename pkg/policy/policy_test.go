@@ -0,0 +1,148 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPolicy = `
+allow:
+  - ig_gadgets list_running_gadgets
+  - ig_gadgets get_*
+  - ig_deploy
+  - gadget_trace_*
+deny:
+  - ig_deploy undeploy
+  - gadget_trace_exec
+maxDuration: 1m
+forbidBackground: true
+params:
+  gadget_*:
+    - operator.KubeManager.*
+    - operator.filter.filter
+`
+
+func duration(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestCheck(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("parsing policy: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		call Call
+		want string
+	}{
+		{name: "allowed action", call: Call{Tool: "ig_gadgets", Action: "list_running_gadgets"}},
+		{name: "allowed action pattern", call: Call{Tool: "ig_gadgets", Action: "get_results"}},
+		{name: "action not allowed", call: Call{Tool: "ig_gadgets", Action: "stop_gadget"}, want: "action stop_gadget of tool ig_gadgets is not allowed"},
+		{name: "allowed tool", call: Call{Tool: "ig_deploy", Action: "deploy"}},
+		{name: "denied action", call: Call{Tool: "ig_deploy", Action: "undeploy"}, want: "action undeploy of tool ig_deploy is denied"},
+		{name: "denied tool", call: Call{Tool: "gadget_trace_exec", Duration: duration(time.Second)}, want: "gadget_trace_exec is denied"},
+		{name: "tool not allowed", call: Call{Tool: "gadget_top_file", Duration: duration(time.Second)}, want: "gadget_top_file is not allowed"},
+		{name: "gadget", call: Call{Tool: "gadget_trace_dns", Duration: duration(time.Minute), Params: []string{"operator.KubeManager.namespace", "operator.filter.filter"}}},
+		{name: "duration too long", call: Call{Tool: "gadget_trace_dns", Duration: duration(2 * time.Minute)}, want: "at most 1m0s, set a duration of at most 60 seconds"},
+		{name: "background", call: Call{Tool: "gadget_trace_dns", Duration: duration(0)}, want: "background (duration 0) is forbidden"},
+		{name: "param not allowed", call: Call{Tool: "gadget_trace_dns", Duration: duration(time.Second), Params: []string{"operator.oci.ebpf.map-fetch-interval"}}, want: "param operator.oci.ebpf.map-fetch-interval of gadget_trace_dns can't be set"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.Check(tc.call)
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("expected the call to be allowed, got %v", err)
+				}
+				return
+			}
+			var v *Violation
+			if !errors.As(err, &v) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected a violation containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestToolAllowed(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("parsing policy: %v", err)
+	}
+	for tool, want := range map[string]bool{
+		// tools with some allowed actions are offered
+		"ig_gadgets":        true,
+		"ig_deploy":         true,
+		"gadget_trace_dns":  true,
+		"gadget_trace_exec": false,
+		"gadget_top_file":   false,
+	} {
+		if got := p.ToolAllowed(tool); got != want {
+			t.Errorf("expected ToolAllowed(%s) to be %v, got %v", tool, want, got)
+		}
+	}
+
+	var none *Policy
+	if !none.ToolAllowed("ig_deploy") || none.Check(Call{Tool: "ig_deploy", Action: "undeploy"}) != nil {
+		t.Error("expected a nil policy to allow everything")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"unknown key":       "alow: [ig_deploy]",
+		"invalid pattern":   "deny: ['gadget_[']",
+		"too many fields":   "deny: [ig_deploy undeploy now]",
+		"invalid duration":  "maxDuration: soon",
+		"too short":         "maxDuration: 10ms",
+		"invalid param key": "params: {gadget_*: ['[']}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(data)); err == nil {
+				t.Error("expected parsing to fail")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(testPolicy), 0o600); err != nil {
+		t.Fatalf("writing policy: %v", err)
+	}
+	p, err := Load(file)
+	if err != nil {
+		t.Fatalf("loading policy: %v", err)
+	}
+	if p.MaxDuration != time.Minute || !p.ForbidBackground {
+		t.Errorf("unexpected policy %+v", p)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.yaml")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatalf("writing policy: %v", err)
+	}
+	if _, err := Load(empty); err != nil {
+		t.Errorf("expected an empty policy to be valid, got %v", err)
+	}
+}
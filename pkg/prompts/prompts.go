@@ -0,0 +1,163 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prompts provides MCP prompts guiding the model through common
+// investigations with the gadget tools.
+package prompts
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"text/template"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// promptData is passed to the prompt templates
+type promptData struct {
+	Environment string
+	// Compact is true if the gadgets are run using ig_run
+	Compact bool
+	// Namespace, Pod and Container narrow down the workloads to investigate
+	Namespace string
+	Pod       string
+	Container string
+	// Activity is the operation to observe
+	Activity string
+}
+
+type prompt struct {
+	name        string
+	description string
+	// kubernetesOnly prompts aren't registered in the linux environment
+	kubernetesOnly bool
+	// targetRequired makes the workload to investigate a required argument
+	targetRequired bool
+	// activity adds an argument for the operation to observe
+	activity bool
+}
+
+var prompts = []prompt{
+	{
+		name:        "debug_dns",
+		description: "Debug DNS resolution issues of a workload by tracing its DNS traffic, failed lookups and latencies",
+	},
+	{
+		name:        "security_observability",
+		description: "Look for suspicious activity like unexpected process executions or access to sensitive files",
+	},
+	{
+		name:           "record_syscalls",
+		description:    "Record and explain the syscalls of a workload to understand what it does at the system level",
+		targetRequired: true,
+	},
+	{
+		name:           "understand_cluster",
+		description:    "Observe what happens behind the scenes in the cluster during an operation like creating a deployment",
+		kubernetesOnly: true,
+		activity:       true,
+	},
+}
+
+// GetPrompts returns the prompts for the given environment and tool mode.
+func GetPrompts(env string, compact bool) ([]server.ServerPrompt, error) {
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"tool": toolFunc(compact),
+	}).ParseFS(templates, "templates/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("parsing templates: %w", err)
+	}
+
+	var serverPrompts []server.ServerPrompt
+	for _, p := range prompts {
+		if p.kubernetesOnly && env != "kubernetes" {
+			continue
+		}
+		serverPrompts = append(serverPrompts, server.ServerPrompt{
+			Prompt:  p.mcpPrompt(env),
+			Handler: promptHandler(tmpl, p, env, compact),
+		})
+	}
+	return serverPrompts, nil
+}
+
+func (p prompt) mcpPrompt(env string) mcp.Prompt {
+	required := func(opts ...mcp.ArgumentOption) []mcp.ArgumentOption {
+		if p.targetRequired {
+			opts = append(opts, mcp.RequiredArgument())
+		}
+		return opts
+	}
+
+	opts := []mcp.PromptOption{mcp.WithPromptDescription(p.description)}
+	if env == "kubernetes" {
+		opts = append(opts,
+			mcp.WithArgument("namespace", required(mcp.ArgumentDescription("Namespace of the workloads, all namespaces if not set"))...),
+			mcp.WithArgument("pod", required(mcp.ArgumentDescription("Name of the pod, all pods of the namespace if not set"))...),
+		)
+	} else {
+		opts = append(opts,
+			mcp.WithArgument("container", required(mcp.ArgumentDescription("Name of the container, all containers if not set"))...),
+		)
+	}
+	if p.activity {
+		opts = append(opts, mcp.WithArgument("activity", mcp.ArgumentDescription("Operation to observe, e.g. 'create an nginx deployment'")))
+	}
+	return mcp.NewPrompt(p.name, opts...)
+}
+
+func promptHandler(tmpl *template.Template, p prompt, env string, compact bool) server.PromptHandlerFunc {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		args := request.Params.Arguments
+		data := promptData{
+			Environment: env,
+			Compact:     compact,
+			Namespace:   args["namespace"],
+			Pod:         args["pod"],
+			Container:   args["container"],
+			Activity:    args["activity"],
+		}
+		if data.Pod != "" && data.Namespace == "" {
+			return nil, errors.New("a namespace is required along with the pod")
+		}
+		if p.targetRequired && data.Pod == "" && data.Container == "" {
+			return nil, errors.New("the workload to investigate is required")
+		}
+
+		var out bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&out, p.name+".tmpl", data); err != nil {
+			return nil, fmt.Errorf("executing template for prompt %s: %w", p.name, err)
+		}
+		return mcp.NewGetPromptResult(p.description, []mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(out.String())),
+		}), nil
+	}
+}
+
+// toolFunc returns a template function referring to the tool running a gadget
+func toolFunc(compact bool) func(gadget string) string {
+	return func(gadget string) string {
+		if compact {
+			return fmt.Sprintf("`ig_run` with gadget `%s`", gadget)
+		}
+		return fmt.Sprintf("`gadget_%s`", gadget)
+	}
+}
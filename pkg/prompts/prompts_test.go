@@ -0,0 +1,141 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prompts
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func getPrompt(t *testing.T, env string, compact bool, name string, args map[string]string) (string, error) {
+	t.Helper()
+	serverPrompts, err := GetPrompts(env, compact)
+	if err != nil {
+		t.Fatalf("getting prompts: %v", err)
+	}
+	for _, p := range serverPrompts {
+		if p.Prompt.Name != name {
+			continue
+		}
+		req := mcp.GetPromptRequest{}
+		req.Params.Arguments = args
+		res, err := p.Handler(context.Background(), req)
+		if err != nil {
+			return "", err
+		}
+		return res.Messages[0].Content.(mcp.TextContent).Text, nil
+	}
+	t.Fatalf("prompt %s not found", name)
+	return "", nil
+}
+
+func TestPrompts(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		compact bool
+		prompt  string
+		args    map[string]string
+		want    []string
+	}{
+		{
+			name:   "dns for a pod",
+			env:    "kubernetes",
+			prompt: "debug_dns",
+			args:   map[string]string{"namespace": "default", "pod": "web"},
+			want:   []string{"pod `web` in namespace `default`", "`gadget_trace_dns`", "`operator.KubeManager.podname` to `web`", "`kube-system`", "`ig_deploy`"},
+		},
+		{
+			name:    "dns in compact mode",
+			env:     "kubernetes",
+			compact: true,
+			prompt:  "debug_dns",
+			want:    []string{"all namespaces", "`ig_run` with gadget `trace_dns`", "`ig_catalog`"},
+		},
+		{
+			name:   "dns in linux",
+			env:    "linux",
+			prompt: "debug_dns",
+			args:   map[string]string{"container": "web"},
+			want:   []string{"container `web`", "`operator.LocalManager.containername` param to `web`", "ig daemon"},
+		},
+		{
+			name:   "security",
+			env:    "kubernetes",
+			prompt: "security_observability",
+			args:   map[string]string{"namespace": "apps"},
+			want:   []string{"namespace `apps`", "`gadget_snapshot_process`", "`gadget_trace_exec`", "`gadget_trace_open`"},
+		},
+		{
+			name:   "syscalls",
+			env:    "kubernetes",
+			prompt: "record_syscalls",
+			args:   map[string]string{"namespace": "kube-system", "pod": "coredns-0"},
+			want:   []string{"`gadget_traceloop`", "same pod"},
+		},
+		{
+			name:   "cluster",
+			env:    "kubernetes",
+			prompt: "understand_cluster",
+			args:   map[string]string{"activity": "create an nginx deployment"},
+			want:   []string{"when I create an nginx deployment", "`duration` to 0", "`get_results`", "`stop_gadget`"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			text, err := getPrompt(t, tc.env, tc.compact, tc.prompt, tc.args)
+			if err != nil {
+				t.Fatalf("getting prompt: %v", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("expected %q in prompt:\n%s", want, text)
+				}
+			}
+			if strings.Contains(text, "<no value>") {
+				t.Errorf("expected all template values to be set:\n%s", text)
+			}
+		})
+	}
+}
+
+func TestPromptsInvalidArguments(t *testing.T) {
+	if _, err := getPrompt(t, "kubernetes", false, "debug_dns", map[string]string{"pod": "web"}); err == nil {
+		t.Error("expected a pod without namespace to fail")
+	}
+	if _, err := getPrompt(t, "linux", false, "record_syscalls", nil); err == nil {
+		t.Error("expected a missing workload to fail")
+	}
+}
+
+func TestPromptsLinux(t *testing.T) {
+	serverPrompts, err := GetPrompts("linux", false)
+	if err != nil {
+		t.Fatalf("getting prompts: %v", err)
+	}
+	for _, p := range serverPrompts {
+		if p.Prompt.Name == "understand_cluster" {
+			t.Error("expected the Kubernetes prompts not to be registered in linux")
+		}
+		for _, arg := range p.Prompt.Arguments {
+			if arg.Name == "namespace" || arg.Name == "pod" {
+				t.Errorf("expected no Kubernetes arguments in linux, got %s for %s", arg.Name, p.Prompt.Name)
+			}
+		}
+	}
+}
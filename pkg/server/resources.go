@@ -0,0 +1,193 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	metadatav1 "github.com/inspektor-gadget/inspektor-gadget/pkg/metadata/v1"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/discoverer"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/tools"
+)
+
+const (
+	// GadgetURIScheme is the scheme of the MCP resources describing gadgets
+	GadgetURIScheme = "gadget://"
+	// CatalogURI is the URI of the resource listing the available gadgets
+	CatalogURI = GadgetURIScheme + "catalog"
+
+	infoSuffix     = "/info"
+	metadataSuffix = "/metadata"
+)
+
+// catalogEntry describes a gadget found by the discoverer
+type catalogEntry struct {
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	Description string `json:"description,omitempty"`
+}
+
+// gadgetInfo is the JSON view of the info of a gadget
+type gadgetInfo struct {
+	Name        string             `json:"name"`
+	Image       string             `json:"image"`
+	Params      []gadgetParam      `json:"params,omitempty"`
+	DataSources []gadgetDataSource `json:"dataSources,omitempty"`
+}
+
+type gadgetParam struct {
+	Key            string   `json:"key"`
+	Description    string   `json:"description,omitempty"`
+	Type           string   `json:"type,omitempty"`
+	DefaultValue   string   `json:"defaultValue,omitempty"`
+	PossibleValues []string `json:"possibleValues,omitempty"`
+	Mandatory      bool     `json:"mandatory,omitempty"`
+}
+
+type gadgetDataSource struct {
+	Name   string        `json:"name"`
+	Fields []gadgetField `json:"fields,omitempty"`
+}
+
+type gadgetField struct {
+	Name           string `json:"name"`
+	Kind           string `json:"kind"`
+	Description    string `json:"description,omitempty"`
+	PossibleValues string `json:"possibleValues,omitempty"`
+}
+
+// addGadgetResources exposes the gadgets known to the registry as resources, so
+// clients can load their details on demand.
+func addGadgetResources(ms *server.MCPServer, registry *tools.GadgetToolRegistry) {
+	ms.AddResource(
+		mcp.NewResource(CatalogURI, "Gadget catalog",
+			mcp.WithResourceDescription("Gadgets available to the server with their image and description"),
+			mcp.WithMIMEType("application/json"),
+		),
+		catalogHandler(registry),
+	)
+	ms.AddResourceTemplate(
+		mcp.NewResourceTemplate(GadgetURIScheme+"{name}"+infoSuffix, "Gadget info",
+			mcp.WithTemplateDescription("Params and datasource fields of a gadget as listed in the gadget catalog, available once Inspektor Gadget is"),
+			mcp.WithTemplateMIMEType("application/json"),
+		),
+		gadgetInfoHandler(registry),
+	)
+	ms.AddResourceTemplate(
+		mcp.NewResourceTemplate(GadgetURIScheme+"{name}"+metadataSuffix, "Gadget metadata",
+			mcp.WithTemplateDescription("Raw metadata of a gadget as listed in the gadget catalog, available once Inspektor Gadget is"),
+			mcp.WithTemplateMIMEType("application/yaml"),
+		),
+		gadgetMetadataHandler(registry),
+	)
+}
+
+func catalogHandler(registry *tools.GadgetToolRegistry) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		entries := []catalogEntry{}
+		for _, g := range registry.Gadgets() {
+			name, err := discoverer.GadgetName(g.Image)
+			if err != nil {
+				log.Warn("Skipping gadget with invalid image", "image", g.Image, "error", err)
+				continue
+			}
+			entries = append(entries, catalogEntry{Name: name, Image: g.Image, Description: g.Description})
+		}
+		return jsonContents(request.Params.URI, entries)
+	}
+}
+
+func gadgetInfoHandler(registry *tools.GadgetToolRegistry) server.ResourceTemplateHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		name := gadgetNameFromURI(request.Params.URI, infoSuffix)
+		info, err := registry.GadgetInfo(name)
+		if err != nil {
+			return nil, fmt.Errorf("getting gadget info: %w", err)
+		}
+		return jsonContents(request.Params.URI, newGadgetInfo(name, info))
+	}
+}
+
+func gadgetMetadataHandler(registry *tools.GadgetToolRegistry) server.ResourceTemplateHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		info, err := registry.GadgetInfo(gadgetNameFromURI(request.Params.URI, metadataSuffix))
+		if err != nil {
+			return nil, fmt.Errorf("getting gadget metadata: %w", err)
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: "application/yaml",
+				Text:     string(info.Metadata),
+			},
+		}, nil
+	}
+}
+
+// gadgetNameFromURI returns the name of the gadget a resource URI refers to
+func gadgetNameFromURI(uri, suffix string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(uri, GadgetURIScheme), suffix)
+}
+
+func newGadgetInfo(name string, info *api.GadgetInfo) gadgetInfo {
+	gi := gadgetInfo{
+		Name:  name,
+		Image: info.ImageName,
+	}
+	for _, p := range info.Params {
+		gi.Params = append(gi.Params, gadgetParam{
+			Key:            p.Prefix + p.Key,
+			Description:    p.Description,
+			Type:           p.TypeHint,
+			DefaultValue:   p.DefaultValue,
+			PossibleValues: p.PossibleValues,
+			Mandatory:      p.IsMandatory,
+		})
+	}
+	for _, ds := range info.DataSources {
+		gds := gadgetDataSource{Name: ds.Name}
+		for _, f := range ds.Fields {
+			gds.Fields = append(gds.Fields, gadgetField{
+				Name:           f.FullName,
+				Kind:           strings.ToLower(f.Kind.String()),
+				Description:    f.Annotations[metadatav1.DescriptionAnnotation],
+				PossibleValues: f.Annotations[metadatav1.ValueOneOfAnnotation],
+			})
+		}
+		gi.DataSources = append(gi.DataSources, gds)
+	}
+	return gi
+}
+
+func jsonContents(uri string, v any) ([]mcp.ResourceContents, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling %s: %w", uri, err)
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      uri,
+			MIMEType: "application/json",
+			Text:     string(buf),
+		},
+	}, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/capture"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgettest"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/tools"
+)
+
+const traceExecImage = "ghcr.io/inspektor-gadget/gadget/trace_exec:latest"
+
+func newTestServer(t *testing.T, mgr *gadgettest.Manager) *Server {
+	t.Helper()
+	// keep the gadget info cache out of the home directory
+	t.Setenv("HOME", t.TempDir())
+
+	registry := tools.NewToolRegistry(mgr, "linux", nil, nil, true)
+	captures, err := capture.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating capture store: %v", err)
+	}
+	srv := New("test", registry, captures)
+	if err := registry.Prepare(context.Background(), []string{traceExecImage}); err != nil {
+		t.Fatalf("preparing registry: %v", err)
+	}
+	return srv
+}
+
+// readResource reads a resource through the MCP server and returns its text or the error message
+func readResource(t *testing.T, srv *Server, uri string) (string, bool) {
+	t.Helper()
+	msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":%q}}`, uri)
+	switch res := srv.mcpServer.HandleMessage(context.Background(), json.RawMessage(msg)).(type) {
+	case mcp.JSONRPCResponse:
+		result := res.Result.(mcp.ReadResourceResult)
+		return result.Contents[0].(mcp.TextResourceContents).Text, true
+	case mcp.JSONRPCError:
+		return res.Error.Message, false
+	default:
+		t.Fatalf("unexpected response %T", res)
+	}
+	return "", false
+}
+
+func TestGadgetResources(t *testing.T) {
+	g := &gadgettest.Gadget{
+		Image:    traceExecImage,
+		Metadata: "name: trace_exec\ndescription: trace process executions\n",
+		Params:   []*api.Param{{Key: "filter", Prefix: "operator.filter.", Description: "filter events"}},
+		DataSources: []gadgettest.DataSource{{
+			Name:   "exec",
+			Fields: []gadgettest.Field{{Name: "proc.comm", Kind: api.Kind_String}},
+		}},
+	}
+	info, err := g.Info()
+	if err != nil {
+		t.Fatalf("creating gadget info: %v", err)
+	}
+	mgr := &gadgettest.Manager{
+		Version: "0.50.1",
+		Infos:   map[string]*api.GadgetInfo{"ghcr.io/inspektor-gadget/gadget/trace_exec:v0.50.1": info},
+	}
+	srv := newTestServer(t, mgr)
+
+	tests := []struct {
+		uri    string
+		wantOK bool
+		want   []string
+	}{
+		{uri: CatalogURI, wantOK: true, want: []string{`"name":"trace_exec"`, `"image":"` + traceExecImage + `"`}},
+		{uri: "gadget://trace_exec/info", wantOK: true, want: []string{`"key":"operator.filter.filter"`, `"name":"proc.comm","kind":"string"`}},
+		{uri: "gadget://trace_exec/metadata", wantOK: true, want: []string{"description: trace process executions"}},
+		{uri: "gadget://trace_dns/info", want: []string{"unknown gadget: trace_dns"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.uri, func(t *testing.T) {
+			text, ok := readResource(t, srv, tc.uri)
+			if ok != tc.wantOK {
+				t.Fatalf("expected success %v, got %v: %s", tc.wantOK, ok, text)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("expected %q in %s", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestGadgetResourcesNotAvailable(t *testing.T) {
+	srv := newTestServer(t, &gadgettest.Manager{})
+
+	if text, ok := readResource(t, srv, CatalogURI); !ok || !strings.Contains(text, `"name":"trace_exec"`) {
+		t.Errorf("expected the catalog to list the gadget, got %s", text)
+	}
+	if text, ok := readResource(t, srv, "gadget://trace_exec/info"); ok || !strings.Contains(text, "not available") {
+		t.Errorf("expected the info to be unavailable, got %s", text)
+	}
+}
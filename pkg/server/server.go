@@ -16,13 +16,19 @@ package server
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
+	"strings"
 
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/capture"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/prompts"
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/tools"
 )
 
@@ -42,17 +48,46 @@ type Server struct {
 	sseSever    *server.SSEServer
 	httpServer  *server.StreamableHTTPServer
 	stdioCancel func()
+	filters     *sessionFilters
 }
 
-// New creates a new instance of the Inspektor Gadget MCP server.
-func New(version string, registry *tools.GadgetToolRegistry) *Server {
+// New creates a new instance of the Inspektor Gadget MCP server. Captures are only
+// exposed as resources if a store is given.
+func New(version string, registry *tools.GadgetToolRegistry, captures *capture.Store) *Server {
+	filters := newSessionFilters()
 	ms := server.NewMCPServer(
 		"ig-mcp-server",
 		version,
 		server.WithLogging(),
 		server.WithRecovery(),
+		server.WithResourceCapabilities(false, false),
+		server.WithPromptCapabilities(false),
+		// the tools change once Inspektor Gadget becomes available
+		server.WithToolCapabilities(true),
+		server.WithToolFilter(filterSessionTools),
+		server.WithToolHandlerMiddleware(sessionToolMiddleware),
+		server.WithHooks(filters.hooks()),
 	)
 
+	// Expose packet captures written by gadgets as resources, if they are stored
+	if captures != nil {
+		ms.AddResourceTemplate(
+			mcp.NewResourceTemplate(capture.URIScheme+"{name}", "Packet capture",
+				mcp.WithTemplateDescription("pcapng file with the raw packets captured by a gadget run, as referenced in the run's results"),
+				mcp.WithTemplateMIMEType(capture.MIMEType),
+			),
+			captureHandler(captures),
+		)
+	}
+	addGadgetResources(ms, registry)
+
+	// Guide the model through common investigations
+	serverPrompts, err := prompts.GetPrompts(registry.Environment(), registry.ToolMode() == tools.ToolModeCompact)
+	if err != nil {
+		log.Warn("Failed to load prompts", "error", err)
+	}
+	ms.AddPrompts(serverPrompts...)
+
 	// Register callback to register tools
 	registry.RegisterCallback(func(tools ...server.ServerTool) {
 		ms.SetTools(tools...)
@@ -60,6 +95,24 @@ func New(version string, registry *tools.GadgetToolRegistry) *Server {
 
 	return &Server{
 		mcpServer: ms,
+		filters:   filters,
+	}
+}
+
+func captureHandler(captures *capture.Store) server.ResourceTemplateHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		name := strings.TrimPrefix(request.Params.URI, capture.URIScheme)
+		buf, err := captures.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{
+			mcp.BlobResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: capture.MIMEType,
+				Blob:     base64.StdEncoding.EncodeToString(buf),
+			},
+		}, nil
 	}
 }
 
@@ -73,11 +126,13 @@ func (s *Server) Start(transport, host, port string) error {
 		return server.NewStdioServer(s.mcpServer).Listen(ctx, os.Stdin, os.Stdout)
 	case SSETransport:
 		log.Info("Starting MCP server", "transport", transport, "host", host, "port", port)
-		s.sseSever = server.NewSSEServer(s.mcpServer)
+		srv := &http.Server{}
+		s.sseSever = server.NewSSEServer(s.mcpServer, server.WithHTTPServer(srv), server.WithSSEContextFunc(s.filters.context))
+		srv.Handler = s.filters.sseHandler(s.sseSever)
 		return s.sseSever.Start(net.JoinHostPort(host, port))
 	case StreamableHTTPTransport:
 		log.Info("Starting MCP server", "transport", transport, "host", host, "port", port)
-		s.httpServer = server.NewStreamableHTTPServer(s.mcpServer)
+		s.httpServer = server.NewStreamableHTTPServer(s.mcpServer, server.WithHTTPContextFunc(s.filters.context))
 		return s.httpServer.Start(net.JoinHostPort(host, port))
 	}
 	return fmt.Errorf("unsupported transport: %s", transport)
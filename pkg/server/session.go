@@ -0,0 +1,160 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/tools"
+)
+
+// The tools of a session can be narrowed down further than the server-wide
+// filter using these headers, or query parameters of the endpoint URL, with the
+// syntax of the -enable-tools and -disable-tools flags. The filter is taken from
+// the request opening the session, i.e. the SSE connection or the initialize
+// request, and kept for all its later requests.
+const (
+	EnableToolsHeader  = "X-IG-Enable-Tools"
+	DisableToolsHeader = "X-IG-Disable-Tools"
+	EnableToolsQuery   = "enable-tools"
+	DisableToolsQuery  = "disable-tools"
+)
+
+type sessionFilterKey struct{}
+
+type sessionFilter struct {
+	filter *tools.ToolFilter
+	err    error
+}
+
+// sessionFilters keeps the tool filters of the open sessions by their ID.
+type sessionFilters struct {
+	mu      sync.Mutex
+	filters map[string]sessionFilter
+}
+
+func newSessionFilters() *sessionFilters {
+	return &sessionFilters{filters: make(map[string]sessionFilter)}
+}
+
+// hooks returns the hooks keeping track of the filters of the sessions.
+func (s *sessionFilters) hooks() *server.Hooks {
+	hooks := &server.Hooks{}
+	hooks.AddOnRegisterSession(s.register)
+	hooks.AddOnUnregisterSession(s.unregister)
+	return hooks
+}
+
+// register stores the filter of the request opening the session.
+func (s *sessionFilters) register(ctx context.Context, session server.ClientSession) {
+	sf, ok := ctx.Value(sessionFilterKey{}).(sessionFilter)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters[session.SessionID()] = sf
+}
+
+func (s *sessionFilters) unregister(ctx context.Context, session server.ClientSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.filters, session.SessionID())
+}
+
+// context stores the tool filter of the session of an HTTP request in its context.
+// Requests of sessions opened without a filter may still carry their own.
+func (s *sessionFilters) context(ctx context.Context, r *http.Request) context.Context {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		s.mu.Lock()
+		sf, ok := s.filters[session.SessionID()]
+		s.mu.Unlock()
+		if ok {
+			return context.WithValue(ctx, sessionFilterKey{}, sf)
+		}
+	}
+	return requestContext(ctx, r)
+}
+
+// sseHandler passes the filter of the SSE connection to the session registration,
+// as the messages of the session are sent to another endpoint without it.
+func (s *sessionFilters) sseHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			r = r.WithContext(requestContext(r.Context(), r))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestContext stores the tool filter requested by an HTTP request in its context.
+func requestContext(ctx context.Context, r *http.Request) context.Context {
+	get := func(header, query string) string {
+		if v := r.Header.Get(header); v != "" {
+			return v
+		}
+		return r.URL.Query().Get(query)
+	}
+	enable := get(EnableToolsHeader, EnableToolsQuery)
+	disable := get(DisableToolsHeader, DisableToolsQuery)
+	if enable == "" && disable == "" {
+		return ctx
+	}
+	filter, err := tools.ParseToolFilter(enable, disable)
+	if err != nil {
+		log.Warn("Invalid session tool filter, hiding all tools", "error", err)
+	}
+	return context.WithValue(ctx, sessionFilterKey{}, sessionFilter{filter: filter, err: err})
+}
+
+// filterSessionTools drops the tools the session didn't enable from tools/list.
+func filterSessionTools(ctx context.Context, list []mcp.Tool) []mcp.Tool {
+	sf, ok := ctx.Value(sessionFilterKey{}).(sessionFilter)
+	if !ok {
+		return list
+	}
+	filtered := make([]mcp.Tool, 0, len(list))
+	if sf.err != nil {
+		return filtered
+	}
+	for _, tool := range list {
+		if sf.filter.Allowed(tool.Name) {
+			filtered = append(filtered, tool)
+		}
+	}
+	return filtered
+}
+
+// sessionToolMiddleware rejects calls to tools the session didn't enable.
+func sessionToolMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if sf, ok := ctx.Value(sessionFilterKey{}).(sessionFilter); ok {
+			if sf.err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid tool filter of the session: %v", sf.err)), nil
+			}
+			if name, ok := sf.filter.CallAllowed(request.Params.Name, request.GetArguments()); !ok {
+				return mcp.NewToolResultError(fmt.Sprintf("tool %s is not enabled for this session", name)), nil
+			}
+			ctx = tools.ContextWithFilter(ctx, sf.filter)
+		}
+		return next(ctx, request)
+	}
+}
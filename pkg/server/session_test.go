@@ -0,0 +1,132 @@
+// Copyright 2025 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestSessionToolFilter(t *testing.T) {
+	list := []mcp.Tool{
+		mcp.NewTool("ig_gadgets"),
+		mcp.NewTool("gadget_trace_dns"),
+		mcp.NewTool("gadget_traceloop"),
+	}
+	called := false
+	handler := sessionToolMiddleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = true
+		return mcp.NewToolResultText("ok"), nil
+	})
+	call := func(ctx context.Context, name string) bool {
+		t.Helper()
+		called = false
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		res, err := handler(ctx, req)
+		if err != nil {
+			t.Fatalf("calling tool: %v", err)
+		}
+		return called && !res.IsError
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		header map[string]string
+		want   []string
+	}{
+		{name: "no filter", target: "/mcp", want: []string{"ig_gadgets", "gadget_trace_dns", "gadget_traceloop"}},
+		{name: "query", target: "/mcp?enable-tools=gadget_*&disable-tools=gadget_traceloop", want: []string{"gadget_trace_dns"}},
+		{name: "header", target: "/mcp", header: map[string]string{EnableToolsHeader: "ig_*,!gadget_*"}, want: []string{"ig_gadgets"}},
+		{name: "invalid", target: "/mcp", header: map[string]string{DisableToolsHeader: "!ig_gadgets"}, want: []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tc.target, nil)
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			ctx := requestContext(context.Background(), r)
+
+			names := []string{}
+			for _, tool := range filterSessionTools(ctx, list) {
+				names = append(names, tool.Name)
+			}
+			if !slices.Equal(names, tc.want) {
+				t.Fatalf("expected tools %v, got %v", tc.want, names)
+			}
+
+			for _, tool := range list {
+				want := slices.Contains(tc.want, tool.Name)
+				if got := call(ctx, tool.Name); got != want {
+					t.Errorf("expected calling %s to be allowed=%v, got %v", tool.Name, want, got)
+				}
+			}
+		})
+	}
+}
+
+type fakeSession struct {
+	id string
+}
+
+func (s fakeSession) Initialize()                                         {}
+func (s fakeSession) Initialized() bool                                   { return true }
+func (s fakeSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return nil }
+func (s fakeSession) SessionID() string                                   { return s.id }
+
+func TestSessionFilterKept(t *testing.T) {
+	filters := newSessionFilters()
+	ms := server.NewMCPServer("test", "0", server.WithHooks(filters.hooks()))
+	list := []mcp.Tool{mcp.NewTool("ig_gadgets"), mcp.NewTool("gadget_trace_dns")}
+	names := func(ctx context.Context) []string {
+		names := []string{}
+		for _, tool := range filterSessionTools(ctx, list) {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+
+	// the SSE connection carries the filter, its messages don't
+	session := fakeSession{id: "s1"}
+	connect := httptest.NewRequest("GET", "/sse?enable-tools=ig_*", nil)
+	if err := ms.RegisterSession(requestContext(context.Background(), connect), session); err != nil {
+		t.Fatalf("registering session: %v", err)
+	}
+	message := httptest.NewRequest("POST", "/message?sessionId=s1", nil)
+	ctx := filters.context(ms.WithContext(context.Background(), session), message)
+	if got := names(ctx); !slices.Equal(got, []string{"ig_gadgets"}) {
+		t.Fatalf("expected the filter of the session, got %v", got)
+	}
+
+	// a request can't widen the filter of its session
+	message.Header.Set(EnableToolsHeader, "*")
+	ctx = filters.context(ms.WithContext(context.Background(), session), message)
+	if got := names(ctx); !slices.Equal(got, []string{"ig_gadgets"}) {
+		t.Fatalf("expected the filter of the session, got %v", got)
+	}
+
+	ms.UnregisterSession(context.Background(), session.id)
+	ctx = filters.context(ms.WithContext(context.Background(), session), httptest.NewRequest("POST", "/message?sessionId=s1", nil))
+	if got := names(ctx); len(got) != len(list) {
+		t.Fatalf("expected the filter to be dropped with the session, got %v", got)
+	}
+}
@@ -0,0 +1,11 @@
+package compact
+
+const (
+	catalogToolName = "ig_catalog"
+
+	// RunToolName is the name of the tool running any of the gadgets
+	RunToolName = "ig_run"
+
+	// gadgetToolPrefix is the prefix of the gadget tools wrapped by the compact tools
+	gadgetToolPrefix = "gadget_"
+)
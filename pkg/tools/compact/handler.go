@@ -0,0 +1,91 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var log = slog.Default().With("component", "compact_tools")
+
+func catalogHandler(c *catalog) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if name := request.GetString("gadget", ""); name != "" {
+			return describeGadget(ctx, c, name)
+		}
+
+		query := request.GetString("query", "")
+		names := c.search(ctx, query)
+		if len(names) == 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("No gadgets found matching %q, call %s without a query to list all gadgets", query, catalogToolName)), nil
+		}
+
+		var sb strings.Builder
+		sb.WriteString("<gadgets>\n")
+		for _, name := range names {
+			fmt.Fprintf(&sb, "- %s: %s\n", name, c.summary(name))
+		}
+		sb.WriteString("</gadgets>\n")
+		fmt.Fprintf(&sb, "Call %s with gadget set to one of the names to get its params and fields, then %s to run it.\n", catalogToolName, RunToolName)
+		return mcp.NewToolResultText(sb.String()), nil
+	}
+}
+
+func describeGadget(ctx context.Context, c *catalog, name string) (*mcp.CallToolResult, error) {
+	t, ok := c.get(ctx, name)
+	if !ok {
+		return unknownGadget(name), nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<gadget name=%q>\n", strings.TrimPrefix(name, gadgetToolPrefix))
+	fmt.Fprintf(&sb, "<description>\n%s\n</description>\n", t.Tool.Description)
+	fmt.Fprintf(&sb, "<arguments>\n%s\n</arguments>\n", arguments(t.Tool))
+	sb.WriteString("</gadget>\n")
+	fmt.Fprintf(&sb, "Pass params and duration to %s directly and any other argument in its arguments object.\n", RunToolName)
+	return mcp.NewToolResultText(sb.String()), nil
+}
+
+func runHandler(c *catalog) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name := request.GetString("gadget", "")
+		if name == "" {
+			return mcp.NewToolResultError("A gadget must be specified, use " + catalogToolName + " to list the available gadgets"), nil
+		}
+		t, ok := c.get(ctx, name)
+		if !ok {
+			return unknownGadget(name), nil
+		}
+
+		// call the gadget tool as if it was called directly
+		args := make(map[string]any)
+		reqArgs := request.GetArguments()
+		if extra, ok := reqArgs["arguments"].(map[string]any); ok {
+			maps.Copy(args, extra)
+		} else if reqArgs["arguments"] != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid type for arguments: expected an object, got %T", reqArgs["arguments"])), nil
+		}
+		for _, key := range []string{"params", "duration"} {
+			if v, ok := reqArgs[key]; ok {
+				args[key] = v
+			}
+		}
+		if args["params"] == nil {
+			args["params"] = map[string]any{}
+		}
+
+		request.Params.Name = t.Tool.Name
+		request.Params.Arguments = args
+		log.Debug("Running gadget tool", "tool", t.Tool.Name)
+		return t.Handler(ctx, request)
+	}
+}
+
+func unknownGadget(name string) *mcp.CallToolResult {
+	return mcp.NewToolResultError(fmt.Sprintf("Unknown gadget %q, use %s to list the available gadgets", name, catalogToolName))
+}
@@ -0,0 +1,190 @@
+package compact
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// gadgetTool returns a gadget tool answering with its name and the arguments it was called with.
+func gadgetTool(name, description string, params ...string) server.ServerTool {
+	var opts []mcp.ToolOption
+	opts = append(opts, mcp.WithDescription(description))
+	if len(params) > 0 {
+		props := make(map[string]any)
+		for _, p := range params {
+			props[p] = map[string]any{"type": "string"}
+		}
+		opts = append(opts, mcp.WithObject("params", mcp.Properties(props)))
+	}
+	return server.ServerTool{
+		Tool: mcp.NewTool(name, opts...),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args, err := json.Marshal(request.GetArguments())
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewToolResultText(request.Params.Name + " " + string(args)), nil
+		},
+	}
+}
+
+func compactTools() map[string]server.ServerTool {
+	gadgetTools := []server.ServerTool{
+		gadgetTool("gadget_trace_exec", "Trace process executions\nDATASOURCE exec\n- proc.comm: command", "operator.filter.filter"),
+		gadgetTool("gadget_trace_dns", "Trace DNS queries and responses\nDATASOURCE dns\n- name: queried name"),
+		gadgetTool("gadget_top_tcp", "Show TCP connections by traffic\nDATASOURCE tcp\n- sent: bytes sent"),
+	}
+	// trace_dns is hidden from the caller, e.g. by the tool filter of the session or the policy
+	allowed := func(ctx context.Context, name string) bool {
+		return name != "gadget_trace_dns"
+	}
+	tools := make(map[string]server.ServerTool)
+	for _, t := range GetTools(gadgetTools, allowed) {
+		tools[t.Tool.Name] = t
+	}
+	return tools
+}
+
+func callTool(t *testing.T, tool server.ServerTool, args map[string]any) (string, bool) {
+	t.Helper()
+	req := mcp.CallToolRequest{}
+	req.Params.Name = tool.Tool.Name
+	req.Params.Arguments = args
+	res, err := tool.Handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("calling %s: %v", tool.Tool.Name, err)
+	}
+	return res.Content[0].(mcp.TextContent).Text, res.IsError
+}
+
+func TestCatalog(t *testing.T) {
+	catalog := compactTools()[catalogToolName]
+
+	tests := []struct {
+		name        string
+		args        map[string]any
+		contains    []string
+		notContains []string
+		isError     bool
+	}{
+		{
+			name:        "list",
+			args:        map[string]any{},
+			contains:    []string{"- top_tcp: Show TCP connections by traffic\n- trace_exec: Trace process executions\n"},
+			notContains: []string{"trace_dns", "DATASOURCE"},
+		},
+		{
+			name:        "search",
+			args:        map[string]any{"query": "Process EXEC"},
+			contains:    []string{"- trace_exec: "},
+			notContains: []string{"top_tcp"},
+		},
+		{
+			name:     "search fields and params",
+			args:     map[string]any{"query": "proc.comm operator.filter"},
+			contains: []string{"- trace_exec: "},
+		},
+		{
+			name:     "search hidden gadget",
+			args:     map[string]any{"query": "dns"},
+			contains: []string{`No gadgets found matching "dns"`},
+		},
+		{
+			name:     "describe",
+			args:     map[string]any{"gadget": "trace_exec"},
+			contains: []string{`<gadget name="trace_exec">`, "- proc.comm: command", `"operator.filter.filter"`},
+		},
+		{
+			name:     "describe with prefix",
+			args:     map[string]any{"gadget": "gadget_trace_exec"},
+			contains: []string{`<gadget name="trace_exec">`},
+		},
+		{
+			name:     "describe hidden gadget",
+			args:     map[string]any{"gadget": "trace_dns"},
+			contains: []string{`Unknown gadget "trace_dns"`},
+			isError:  true,
+		},
+		{
+			name:     "describe unknown gadget",
+			args:     map[string]any{"gadget": "trace_open"},
+			contains: []string{`Unknown gadget "trace_open"`},
+			isError:  true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			text, isError := callTool(t, catalog, tc.args)
+			if isError != tc.isError {
+				t.Fatalf("expected error %v, got %v: %s", tc.isError, isError, text)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(text, s) {
+					t.Errorf("expected %q in:\n%s", s, text)
+				}
+			}
+			for _, s := range tc.notContains {
+				if strings.Contains(text, s) {
+					t.Errorf("expected no %q in:\n%s", s, text)
+				}
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	run := compactTools()[RunToolName]
+
+	tests := []struct {
+		name    string
+		args    map[string]any
+		want    string
+		isError bool
+	}{
+		{
+			name: "run",
+			args: map[string]any{"gadget": "trace_exec", "duration": float64(5), "params": map[string]any{"operator.filter.filter": "proc.comm==sh"}},
+			want: `gadget_trace_exec {"duration":5,"params":{"operator.filter.filter":"proc.comm==sh"}}`,
+		},
+		{
+			name: "arguments",
+			args: map[string]any{"gadget": "gadget_trace_exec", "arguments": map[string]any{"max_events": float64(1), "duration": float64(3)}, "duration": float64(5)},
+			// duration and params are taken from the top level
+			want: `gadget_trace_exec {"duration":5,"max_events":1,"params":{}}`,
+		},
+		{
+			name:    "invalid arguments",
+			args:    map[string]any{"gadget": "trace_exec", "arguments": "max_events=1"},
+			want:    "invalid type for arguments",
+			isError: true,
+		},
+		{
+			name:    "missing gadget",
+			args:    map[string]any{},
+			want:    "A gadget must be specified",
+			isError: true,
+		},
+		{
+			name:    "hidden gadget",
+			args:    map[string]any{"gadget": "trace_dns"},
+			want:    `Unknown gadget "trace_dns"`,
+			isError: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			text, isError := callTool(t, run, tc.args)
+			if isError != tc.isError {
+				t.Fatalf("expected error %v, got %v: %s", tc.isError, isError, text)
+			}
+			if tc.isError && !strings.Contains(text, tc.want) || !tc.isError && text != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, text)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package compact
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// AllowedFunc returns true if the gadget tool with the given name may be used by
+// the client calling the compact tools.
+type AllowedFunc func(ctx context.Context, name string) bool
+
+// GetTools returns the ig_catalog and ig_run tools which expose the given gadget
+// tools through two tools instead of one per gadget, keeping the tool list short.
+// Gadgets whose tools aren't allowed at the time of a call are treated as unknown.
+func GetTools(gadgetTools []server.ServerTool, allowed AllowedFunc) []server.ServerTool {
+	c := newCatalog(gadgetTools, allowed)
+	return []server.ServerTool{
+		{
+			Tool:    catalogTool(),
+			Handler: catalogHandler(c),
+		},
+		{
+			Tool:    runTool(),
+			Handler: runHandler(c),
+		},
+	}
+}
+
+func catalogTool() mcp.Tool {
+	return mcp.NewTool(
+		catalogToolName,
+		mcp.WithDescription("Search the Inspektor Gadget gadgets available to "+RunToolName+". "+
+			"Without arguments it lists all gadgets with a short description, use query to only list the gadgets, params or fields matching some keywords. "+
+			"Set gadget to get the full description of a gadget with its params, fields and the arguments it accepts before running it."),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithString("query",
+			mcp.Description("Keywords to search for in the names, descriptions, params and fields of the gadgets, e.g. 'dns latency'"),
+		),
+		mcp.WithString("gadget",
+			mcp.Description("Name of the gadget to describe, e.g. 'trace_dns'"),
+		),
+	)
+}
+
+func runTool() mcp.Tool {
+	return mcp.NewTool(
+		RunToolName,
+		mcp.WithDescription("Run an Inspektor Gadget gadget and return its events. "+
+			"Use "+catalogToolName+" first to find the gadget and to learn about its params and fields. "+
+			"Running gadgets in the background (duration 0) can be managed with the ig_gadgets tool."),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithString("gadget",
+			mcp.Required(),
+			mcp.Description("Name of the gadget to run as listed by "+catalogToolName+", e.g. 'trace_dns'"),
+		),
+		mcp.WithObject("params",
+			mcp.Description("key-value pairs of parameters to pass to the gadget as described by "+catalogToolName),
+		),
+		mcp.WithNumber("duration",
+			mcp.Description("Duration in seconds to run the gadget. Use 0 to run in background/continuously."),
+		),
+		mcp.WithObject("arguments",
+			mcp.Description("Further arguments of the gadget as described by "+catalogToolName+", e.g. {\"max_events\": 10, \"fields\": [\"k8s.podName\"], \"output_format\": \"csv\"}"),
+		),
+	)
+}
+
+// catalog holds the gadget tools by name
+type catalog struct {
+	tools   map[string]server.ServerTool
+	allowed AllowedFunc
+}
+
+func newCatalog(gadgetTools []server.ServerTool, allowed AllowedFunc) *catalog {
+	c := &catalog{tools: make(map[string]server.ServerTool, len(gadgetTools)), allowed: allowed}
+	for _, t := range gadgetTools {
+		c.tools[strings.TrimPrefix(t.Tool.Name, gadgetToolPrefix)] = t
+	}
+	return c
+}
+
+// names returns the sorted names of the gadgets allowed for the caller
+func (c *catalog) names(ctx context.Context) []string {
+	names := make([]string, 0, len(c.tools))
+	for name, t := range c.tools {
+		if c.allowed == nil || c.allowed(ctx, t.Tool.Name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// get returns the tool of a gadget allowed for the caller, the name can be given
+// with or without the tool prefix
+func (c *catalog) get(ctx context.Context, name string) (server.ServerTool, bool) {
+	t, ok := c.tools[strings.TrimPrefix(name, gadgetToolPrefix)]
+	if !ok || (c.allowed != nil && !c.allowed(ctx, t.Tool.Name)) {
+		return server.ServerTool{}, false
+	}
+	return t, true
+}
+
+// search returns the sorted names of the gadgets allowed for the caller matching
+// all keywords of the query
+func (c *catalog) search(ctx context.Context, query string) []string {
+	keywords := strings.Fields(strings.ToLower(query))
+	var names []string
+	for _, name := range c.names(ctx) {
+		text := strings.ToLower(c.searchText(name))
+		if !slices.ContainsFunc(keywords, func(k string) bool { return !strings.Contains(text, k) }) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// searchText returns the parts of a gadget description specific to the gadget: its
+// name, summary, datasources, fields and params. The rest of the description is the
+// same for all gadgets.
+func (c *catalog) searchText(name string) string {
+	t := c.tools[name].Tool
+	lines := []string{name, c.summary(name)}
+	for _, line := range strings.Split(t.Description, "\n") {
+		if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "DATASOURCE ") {
+			lines = append(lines, line)
+		}
+	}
+	if params, ok := t.InputSchema.Properties["params"]; ok {
+		if schema, err := json.Marshal(params); err == nil {
+			lines = append(lines, string(schema))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// summary returns the first line of the description of a gadget
+func (c *catalog) summary(name string) string {
+	summary, _, _ := strings.Cut(c.tools[name].Tool.Description, "\n")
+	return summary
+}
+
+// arguments returns the JSON schema of the arguments of a gadget tool
+func arguments(t mcp.Tool) string {
+	schema, err := json.Marshal(t.InputSchema)
+	if err != nil {
+		return ""
+	}
+	return string(schema)
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/tools/compact"
+	gadgetsdefault "github.com/inspektor-gadget/ig-mcp-server/pkg/tools/gadgets/default"
+)
+
+// ToolFilter selects tools by name using glob patterns as supported by path.Match,
+// e.g. gadget_trace_*. A nil filter allows all tools.
+type ToolFilter struct {
+	// include holds the patterns a tool must match one of, all tools are included if empty
+	include []string
+	// exclude holds the patterns of tools that are never included
+	exclude []string
+}
+
+// ParseToolFilter creates a filter from comma-separated lists of patterns. Only
+// tools matching one of the enable patterns are kept, or all if there is none.
+// Tools matching one of the disable patterns, or an enable pattern prefixed with
+// !, are dropped. It returns nil if both lists are empty.
+func ParseToolFilter(enable, disable string) (*ToolFilter, error) {
+	f := &ToolFilter{}
+	for _, p := range splitPatterns(enable) {
+		if exclude, ok := strings.CutPrefix(p, "!"); ok {
+			f.exclude = append(f.exclude, exclude)
+			continue
+		}
+		f.include = append(f.include, p)
+	}
+	for _, p := range splitPatterns(disable) {
+		if strings.HasPrefix(p, "!") {
+			return nil, fmt.Errorf("invalid disable pattern %q: negation is only supported in enable patterns", p)
+		}
+		f.exclude = append(f.exclude, p)
+	}
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return nil, nil
+	}
+	for _, p := range append(f.include, f.exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return f, nil
+}
+
+func splitPatterns(patterns string) []string {
+	var res []string
+	for _, p := range strings.Split(patterns, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// Allowed returns true if the tool with the given name passes the filter.
+func (f *ToolFilter) Allowed(name string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+// CallAllowed checks a call of a tool and of the gadget tools it runs, e.g. the gadget
+// run by ig_run or ig_investigate, against the filter. It returns the first tool that isn't allowed.
+func (f *ToolFilter) CallAllowed(name string, args map[string]any) (string, bool) {
+	if !f.Allowed(name) {
+		return name, false
+	}
+	var gadgets []any
+	switch name {
+	case compact.RunToolName:
+		gadgets = []any{args["gadget"]}
+	case gadgetsdefault.InvestigationToolName:
+		entries, _ := args["gadgets"].([]any)
+		for _, entry := range entries {
+			entryArgs, _ := entry.(map[string]any)
+			gadgets = append(gadgets, entryArgs["gadget"])
+		}
+	}
+	for _, gadget := range gadgets {
+		if gadget, ok := gadget.(string); ok && !f.Allowed(gadgetToolPrefix+gadget) {
+			return gadgetToolPrefix + gadget, false
+		}
+	}
+	return "", true
+}
+
+type filterKey struct{}
+
+// ContextWithFilter returns a copy of ctx carrying the tool filter of a session,
+// so that tools listing other tools, like ig_catalog, can apply it as well.
+func ContextWithFilter(ctx context.Context, f *ToolFilter) context.Context {
+	return context.WithValue(ctx, filterKey{}, f)
+}
+
+// FilterFromContext returns the tool filter of the session stored in ctx, or nil
+// if there is none.
+func FilterFromContext(ctx context.Context) *ToolFilter {
+	f, _ := ctx.Value(filterKey{}).(*ToolFilter)
+	return f
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		// patterns are validated when parsing the filter
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
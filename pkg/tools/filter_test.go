@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"testing"
+)
+
+func TestToolFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		enable  string
+		disable string
+		allowed []string
+		denied  []string
+	}{
+		{
+			name:    "no patterns",
+			allowed: []string{"ig_gadgets", "gadget_trace_dns"},
+		},
+		{
+			name:    "enable",
+			enable:  "ig_*, gadget_trace_*",
+			allowed: []string{"ig_gadgets", "gadget_trace_dns"},
+			denied:  []string{"gadget_top_tcp"},
+		},
+		{
+			name:    "negated enable",
+			enable:  "gadget_trace_*,!gadget_traceloop,!gadget_trace_ssl",
+			allowed: []string{"gadget_trace_dns"},
+			denied:  []string{"gadget_traceloop", "gadget_trace_ssl", "ig_gadgets"},
+		},
+		{
+			name:    "only negated enable",
+			enable:  "!gadget_traceloop",
+			allowed: []string{"ig_gadgets", "gadget_trace_dns"},
+			denied:  []string{"gadget_traceloop"},
+		},
+		{
+			name:    "disable",
+			enable:  "gadget_*",
+			disable: "gadget_profile_*,gadget_top_?cp",
+			allowed: []string{"gadget_trace_dns", "gadget_top_file"},
+			denied:  []string{"gadget_profile_blockio", "gadget_top_tcp"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseToolFilter(tc.enable, tc.disable)
+			if err != nil {
+				t.Fatalf("parsing filter: %v", err)
+			}
+			for _, name := range tc.allowed {
+				if !f.Allowed(name) {
+					t.Errorf("expected %s to be allowed", name)
+				}
+			}
+			for _, name := range tc.denied {
+				if f.Allowed(name) {
+					t.Errorf("expected %s to be denied", name)
+				}
+			}
+		})
+	}
+}
+
+func TestParseToolFilterInvalid(t *testing.T) {
+	if _, err := ParseToolFilter("gadget_[", ""); err == nil {
+		t.Error("expected a malformed pattern to fail")
+	}
+	if _, err := ParseToolFilter("", "!gadget_trace_dns"); err == nil {
+		t.Error("expected a negated disable pattern to fail")
+	}
+}
+
+func TestToolFilterCallAllowed(t *testing.T) {
+	f, err := ParseToolFilter("ig_*,gadget_trace_*", "gadget_trace_exec")
+	if err != nil {
+		t.Fatalf("parsing filter: %v", err)
+	}
+	tests := []struct {
+		name   string
+		tool   string
+		args   map[string]any
+		denied string
+	}{
+		{name: "tool", tool: "ig_gadgets"},
+		{name: "denied tool", tool: "gadget_top_tcp", denied: "gadget_top_tcp"},
+		{name: "run", tool: "ig_run", args: map[string]any{"gadget": "trace_dns"}},
+		{name: "denied run", tool: "ig_run", args: map[string]any{"gadget": "trace_exec"}, denied: "gadget_trace_exec"},
+		{name: "investigation", tool: "ig_investigate", args: map[string]any{"gadgets": []any{
+			map[string]any{"gadget": "trace_dns"},
+			map[string]any{"gadget": "trace_tcp"},
+		}}},
+		{name: "denied investigation", tool: "ig_investigate", args: map[string]any{"gadgets": []any{
+			map[string]any{"gadget": "trace_dns"},
+			map[string]any{"gadget": "trace_exec"},
+		}}, denied: "gadget_trace_exec"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			denied, ok := f.CallAllowed(tc.tool, tc.args)
+			if ok != (tc.denied == "") || denied != tc.denied {
+				t.Fatalf("expected %q to be denied, got %q (allowed=%v)", tc.denied, denied, ok)
+			}
+		})
+	}
+}
@@ -2,8 +2,11 @@ package _default
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"time"
 
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
@@ -19,7 +22,18 @@ type ToolData struct {
 	Name        string
 	Description string
 	Environment string
-	Fields      []FieldData
+	DataSources []DataSourceData
+	// Hosts holds the daemons the gadget runs on if there is more than one
+	Hosts []string
+	// PacketFields holds the fields of the gadget with raw packets
+	PacketFields []string
+}
+
+type DataSourceData struct {
+	Name string
+	// Hidden is true if the datasource is not included in the output unless selected explicitly
+	Hidden bool
+	Fields []FieldData
 }
 
 type FieldData struct {
@@ -28,48 +42,119 @@ type FieldData struct {
 	PossibleValues string
 }
 
+// structuredResult is the structured content of a foreground run, see resultSchema.
+type structuredResult struct {
+	Records        []json.RawMessage `json:"records"`
+	Truncated      bool              `json:"truncated"`
+	TotalEvents    int               `json:"totalEvents"`
+	OmittedRecords int               `json:"omittedRecords,omitempty"`
+	Duration       float64           `json:"duration"`
+	StoppedEarly   string            `json:"stoppedEarly,omitempty"`
+	Cancelled      bool              `json:"cancelled,omitempty"`
+	HostErrors     map[string]string `json:"hostErrors,omitempty"`
+}
+
+func newStructuredResult(result *gadgetmanager.Result) structuredResult {
+	res := structuredResult{
+		Records:        result.Records,
+		Truncated:      result.OmittedRecords > 0,
+		TotalEvents:    result.TotalEvents,
+		OmittedRecords: result.OmittedRecords,
+		Duration:       result.Duration.Seconds(),
+		StoppedEarly:   result.StoppedEarly,
+		Cancelled:      result.Cancelled,
+	}
+	if res.Records == nil {
+		res.Records = []json.RawMessage{}
+	}
+	for host, err := range result.HostErrors {
+		if res.HostErrors == nil {
+			res.HostErrors = make(map[string]string)
+		}
+		res.HostErrors[host] = err.Error()
+	}
+	return res
+}
+
 func gadgetHandler(mgr gadgetmanager.GadgetManager, info *api.GadgetInfo) server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		duration := 10 * time.Second
-		params := defaultParamsFromGadgetInfo(info)
 		args := request.GetArguments()
-		background := false
-		if args != nil {
-			if t, ok := args["duration"].(float64); ok {
-				duration = time.Duration(t) * time.Second
+		if t, ok := args["duration"].(float64); ok {
+			duration = time.Duration(t) * time.Second
+		}
+		background := duration == 0
+		// If params is provided, merge it with the default parameters
+		p, _ := args["params"].(map[string]interface{})
+		params, err := runParams(info, p, duration)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		opts, err := runOptionsFromArgs(args, info, mgr.Hosts())
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if background {
+			if args["aggregate"] != nil {
+				return mcp.NewToolResultError("aggregate is not supported when running the gadget in background (duration 0)"), nil
 			}
-			if duration == 0 {
-				background = true
+			if args["dedupe"] != nil {
+				return mcp.NewToolResultError("dedupe is not supported when running the gadget in background (duration 0)"), nil
 			}
-			// set map-fetch-interval to half of the duration to limit the volume of data fetched
-			if _, ok := params["operator.oci.ebpf.map-fetch-interval"]; ok && !background {
-				params["operator.oci.ebpf.map-fetch-interval"] = (duration / 2).String()
+			if args["max_events"] != nil || args["stop_when"] != nil {
+				return mcp.NewToolResultError("max_events and stop_when are not supported when running the gadget in background (duration 0)"), nil
 			}
-			// If params is provided, merge it with the default parameters
-			if p, ok := args["params"].(map[string]interface{}); ok {
-				for k, v := range p {
-					if strVal, ok := v.(string); ok {
-						params[k] = strVal
-					} else {
-						return nil, fmt.Errorf("invalid type for parameter %s: expected string, got %T", k, v)
-					}
-				}
+			var hosts []string
+			if args["hosts"] != nil {
+				// the argument was validated together with the run options
+				hosts, _ = parseHosts(args["hosts"], mgr.Hosts())
 			}
-		}
-
-		if background {
-			id, err := mgr.RunDetached(info.ImageName, params)
-			if err != nil {
+			id, err := mgr.RunDetached(ctx, info.ImageName, params, hosts)
+			var hostErrs gadgetmanager.HostErrors
+			if err != nil && (id == "" || !errors.As(err, &hostErrs)) {
 				return nil, fmt.Errorf("running gadget: %w", err)
 			}
-			return mcp.NewToolResultText(fmt.Sprintf("The gadget has been started with ID %s.", id)), nil
+			msg := fmt.Sprintf("The gadget has been started with ID %s.", id)
+			if len(hostErrs) > 0 {
+				msg += " It could not be started on all hosts:" + hostErrs.String()
+			}
+			return mcp.NewToolResultStructured(map[string]any{"instanceId": id}, msg), nil
 		}
 
+		// stream events to the client while the gadget runs if it asked for progress
+		if pn := newProgressNotifier(ctx, request, duration); pn != nil {
+			pn.Start()
+			defer pn.Stop()
+			opts = append(opts, gadgetmanager.WithSink(pn.Sink))
+		}
+
+		var result gadgetmanager.Result
+		opts = append(opts, gadgetmanager.WithResult(&result))
+
 		log.Debug("Running gadget", "image", info.ImageName, "params", params, "duration", duration)
-		resp, err := mgr.Run(info.ImageName, params, duration)
+		resp, err := mgr.Run(ctx, info.ImageName, params, duration, opts...)
 		if err != nil {
 			return nil, fmt.Errorf("starting gadget %s: %w", info.ImageName, err)
 		}
-		return mcp.NewToolResultText(resp), nil
+		// the text form is kept for clients that don't support structured content
+		return mcp.NewToolResultStructured(newStructuredResult(&result), resp), nil
+	}
+}
+
+// runParams merges the validated params passed by the client with the defaults of
+// the gadget for a run of the given duration, 0 being a run in background.
+func runParams(info *api.GadgetInfo, values map[string]any, duration time.Duration) (map[string]string, error) {
+	params := defaultParamsFromGadgetInfo(info)
+	// set map-fetch-interval to half of the duration to limit the volume of data fetched
+	if _, ok := params["operator.oci.ebpf.map-fetch-interval"]; ok && duration > 0 {
+		params["operator.oci.ebpf.map-fetch-interval"] = (duration / 2).String()
+	}
+	validated, err := validateParams(info, values)
+	if err != nil {
+		return nil, err
 	}
+	maps.Copy(params, validated)
+	return params, nil
 }
@@ -0,0 +1,257 @@
+package _default
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgettest"
+)
+
+func traceExec(t *testing.T) *api.GadgetInfo {
+	t.Helper()
+	g := &gadgettest.Gadget{
+		Image:    "trace_exec",
+		Metadata: "name: trace_exec\n",
+		Params: []*api.Param{
+			{Key: "filter", Prefix: "operator.filter."},
+			{Key: "map-fetch-interval", Prefix: "operator.oci.ebpf.", DefaultValue: "1s"},
+		},
+		DataSources: []gadgettest.DataSource{{
+			Name: "exec",
+			Fields: []gadgettest.Field{
+				{Name: "proc.comm", Kind: api.Kind_String},
+				{Name: "error", Kind: api.Kind_Int32},
+			},
+		}},
+	}
+	info, err := g.Info()
+	if err != nil {
+		t.Fatalf("creating gadget info: %v", err)
+	}
+	return info
+}
+
+func callTool(t *testing.T, mgr *gadgettest.Manager, info *api.GadgetInfo, args map[string]any) (*mcp.CallToolResult, error) {
+	t.Helper()
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = args
+	return gadgetHandler(mgr, info)(context.Background(), req)
+}
+
+func resultText(t *testing.T, res *mcp.CallToolResult) string {
+	t.Helper()
+	if len(res.Content) != 1 {
+		t.Fatalf("expected a single content, got %d", len(res.Content))
+	}
+	text, ok := res.Content[0].(mcp.TextContent)
+	if !ok {
+		t.Fatalf("expected text content, got %T", res.Content[0])
+	}
+	return text.Text
+}
+
+func TestGadgetHandler(t *testing.T) {
+	info := traceExec(t)
+	mgr := &gadgettest.Manager{Results: map[string]string{"trace_exec": "\n<results></results>\n"}}
+
+	res, err := callTool(t, mgr, info, map[string]any{
+		"params":        map[string]any{"operator.filter.filter": "error!=0"},
+		"duration":      float64(4),
+		"output_format": "csv",
+		"fields":        []any{"proc.comm"},
+	})
+	if err != nil {
+		t.Fatalf("calling tool: %v", err)
+	}
+	if res.IsError || resultText(t, res) != mgr.Results["trace_exec"] {
+		t.Fatalf("expected the results of the gadget, got %+v", res)
+	}
+
+	calls := mgr.Calls()
+	if len(calls) != 1 || calls[0].Method != "Run" {
+		t.Fatalf("expected a single run, got %+v", calls)
+	}
+	run := calls[0]
+	if run.Timeout != 4*time.Second {
+		t.Errorf("expected a timeout of 4s, got %s", run.Timeout)
+	}
+	if got := run.Params["operator.filter.filter"]; got != "error!=0" {
+		t.Errorf("expected the filter param to be passed, got %q", got)
+	}
+	if got := run.Params["operator.oci.ebpf.map-fetch-interval"]; got != "2s" {
+		t.Errorf("expected the map fetch interval to be half of the duration, got %q", got)
+	}
+	if run.Options != 3 {
+		t.Errorf("expected the format, fields and result options, got %d options", run.Options)
+	}
+}
+
+func TestGadgetHandlerBackground(t *testing.T) {
+	info := traceExec(t)
+	mgr := &gadgettest.Manager{}
+
+	res, err := callTool(t, mgr, info, map[string]any{"params": map[string]any{}, "duration": float64(0)})
+	if err != nil {
+		t.Fatalf("calling tool: %v", err)
+	}
+	instances, _ := mgr.ListGadgets(context.Background())
+	if len(instances) != 1 {
+		t.Fatalf("expected the gadget to be started in the background, got %d instances", len(instances))
+	}
+	if text := resultText(t, res); !strings.Contains(text, instances[0].ID) {
+		t.Errorf("expected the result to contain the ID %s, got %q", instances[0].ID, text)
+	}
+}
+
+func TestGadgetHandlerBackgroundHosts(t *testing.T) {
+	info := traceExec(t)
+	mgr := &gadgettest.Manager{HostList: []string{"host1", "host2"}}
+
+	if _, err := callTool(t, mgr, info, map[string]any{"duration": float64(0), "hosts": []any{"host2"}}); err != nil {
+		t.Fatalf("calling tool: %v", err)
+	}
+	calls := mgr.Calls()
+	if len(calls) != 1 || calls[0].Method != "RunDetached" || !slices.Equal(calls[0].Hosts, []string{"host2"}) {
+		t.Errorf("expected the gadget to be started in the background on host2, got %+v", calls)
+	}
+}
+
+func TestGadgetHandlerInvalidArguments(t *testing.T) {
+	info := traceExec(t)
+
+	tests := []struct {
+		name string
+		args map[string]any
+	}{
+		{name: "unknown format", args: map[string]any{"output_format": "xml"}},
+		{name: "unknown field", args: map[string]any{"fields": []any{"proc.pid"}}},
+		{name: "aggregate and dedupe", args: map[string]any{
+			"aggregate": map[string]any{"group_by": []any{"proc.comm"}},
+			"dedupe":    map[string]any{},
+		}},
+		{name: "aggregate in background", args: map[string]any{
+			"duration":  float64(0),
+			"aggregate": map[string]any{"group_by": []any{"proc.comm"}},
+		}},
+		{name: "max_events in background", args: map[string]any{"duration": float64(0), "max_events": float64(1)}},
+		{name: "unknown param", args: map[string]any{"params": map[string]any{"operator.filter.filtr": "error!=0"}}},
+		{name: "param of wrong type", args: map[string]any{"params": map[string]any{"operator.filter.filter": []any{"error!=0"}}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := &gadgettest.Manager{}
+			res, err := callTool(t, mgr, info, tc.args)
+			if err != nil {
+				t.Fatalf("expected a tool error, got %v", err)
+			}
+			if !res.IsError {
+				t.Errorf("expected a tool error, got %q", resultText(t, res))
+			}
+			if calls := mgr.Calls(); len(calls) != 0 {
+				t.Errorf("expected the gadget not to be run, got %+v", calls)
+			}
+		})
+	}
+}
+
+func TestGadgetHandlerStructured(t *testing.T) {
+	g := &gadgettest.Gadget{
+		Image:    "trace_exec",
+		Metadata: "name: trace_exec\n",
+		DataSources: []gadgettest.DataSource{{
+			Name: "exec",
+			Fields: []gadgettest.Field{
+				{Name: "proc.comm", Kind: api.Kind_String},
+				{Name: "proc.pid", Kind: api.Kind_Uint32},
+			},
+		}},
+	}
+	for i, comm := range []string{"curl", "sh", "curl", "sh"} {
+		g.Events = append(g.Events, gadgettest.Event{Values: map[string]any{"proc.comm": comm, "proc.pid": i + 1}})
+	}
+	info, err := g.Info()
+	if err != nil {
+		t.Fatalf("creating gadget info: %v", err)
+	}
+	svc, err := gadgettest.NewService(t.TempDir(), "0.50.1", g)
+	if err != nil {
+		t.Fatalf("starting service: %v", err)
+	}
+	t.Cleanup(svc.Close)
+	mgr, err := gadgetmanager.NewGadgetManager("linux", svc.Address(), nil, "")
+	if err != nil {
+		t.Fatalf("creating gadget manager: %v", err)
+	}
+	fields := resultSchema(info, nil).Properties["records"].(map[string]any)["items"].(map[string]any)["properties"].(map[string]any)
+
+	tests := []struct {
+		name        string
+		args        map[string]any
+		wantRecords int
+		truncated   bool
+	}{
+		{name: "events", args: map[string]any{}, wantRecords: 4},
+		// the text and the records share the budget
+		{name: "truncated", args: map[string]any{"result_budget": "160"}, wantRecords: 2, truncated: true},
+		{name: "deduped", args: map[string]any{"dedupe": map[string]any{"key": []any{"proc.comm"}}}, wantRecords: 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.args["params"] = map[string]any{}
+			tc.args["duration"] = float64(1)
+			tc.args["max_events"] = float64(4)
+			req := mcp.CallToolRequest{}
+			req.Params.Arguments = tc.args
+			res, err := gadgetHandler(mgr, info)(context.Background(), req)
+			if err != nil {
+				t.Fatalf("calling tool: %v", err)
+			}
+			// the text form is still returned
+			if text := resultText(t, res); res.IsError || !strings.Contains(text, "<results>") {
+				t.Fatalf("expected the results as text, got %q", text)
+			}
+
+			result, ok := res.StructuredContent.(structuredResult)
+			if !ok {
+				t.Fatalf("expected a structured result, got %T", res.StructuredContent)
+			}
+			if b, ok := tc.args["result_budget"].(string); ok {
+				text := resultText(t, res)
+				size := len(text[strings.Index(text, "<results>")+len("<results>") : strings.Index(text, "</results>")])
+				for _, rec := range result.Records {
+					size += len(rec) + 1
+				}
+				if limit, _ := strconv.Atoi(b); size > limit {
+					t.Errorf("expected the text and the records to fit into the budget of %d bytes together, got %d", limit, size)
+				}
+			}
+			if len(result.Records) != tc.wantRecords {
+				t.Errorf("expected %d records, got %d", tc.wantRecords, len(result.Records))
+			}
+			if result.TotalEvents != 4 || result.Truncated != tc.truncated || result.StoppedEarly == "" || result.Duration <= 0 {
+				t.Errorf("unexpected metadata %+v", result)
+			}
+			for _, rec := range result.Records {
+				var values map[string]any
+				if err := json.Unmarshal(rec, &values); err != nil {
+					t.Fatalf("decoding record: %v", err)
+				}
+				for key := range values {
+					// deduped records hold their count and when they were seen next to the fields
+					if _, ok := fields[key]; !ok && !slices.Contains([]string{"count", "first_seen", "last_seen"}, key) {
+						t.Errorf("expected the record %s to only hold fields of the output schema, got %q", rec, key)
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package _default
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	metadatav1 "github.com/inspektor-gadget/inspektor-gadget/pkg/metadata/v1"
+	ebpftypes "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/ebpf/types"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
 )
 
 func defaultParamsFromGadgetInfo(info *api.GadgetInfo) map[string]string {
@@ -14,6 +19,70 @@ func defaultParamsFromGadgetInfo(info *api.GadgetInfo) map[string]string {
 	return params
 }
 
+// fieldNamesFromGadgetInfo returns the full names of all fields of the gadget's datasources.
+func fieldNamesFromGadgetInfo(info *api.GadgetInfo, hosts []string) []string {
+	var fields []string
+	for _, ds := range info.DataSources {
+		for _, f := range ds.Fields {
+			if !slices.Contains(fields, f.FullName) {
+				fields = append(fields, f.FullName)
+			}
+		}
+	}
+	// events of gadgets with multiple datasources are tagged with their datasource
+	if len(info.DataSources) > 1 {
+		fields = append(fields, gadgetmanager.DataSourceField)
+	}
+	// as are events of gadgets running on multiple hosts with their host
+	if len(hosts) > 0 {
+		fields = append(fields, gadgetmanager.HostField)
+	}
+	for _, f := range rawPacketFields(info) {
+		fields = append(fields, f+gadgetmanager.PacketLayersSuffix)
+	}
+	return fields
+}
+
+// timestampFields returns the full names of the fields holding the time of an event,
+// the raw ones tagged by the ebpf operator and the ones formatted from them.
+func timestampFields(info *api.GadgetInfo) []string {
+	var fields []string
+	for _, ds := range info.DataSources {
+		for _, f := range ds.Fields {
+			if !slices.Contains(f.Tags, "type:"+ebpftypes.TimestampTypeName) && f.Annotations[metadatav1.TemplateAnnotation] != "timestamp" {
+				continue
+			}
+			if !slices.Contains(fields, f.FullName) {
+				fields = append(fields, f.FullName)
+			}
+		}
+	}
+	return fields
+}
+
+// rawPacketFields returns the full names of the fields holding raw packets, their
+// decoded layers are added to the events.
+func rawPacketFields(info *api.GadgetInfo) []string {
+	var fields []string
+	for _, ds := range info.DataSources {
+		rest := ds.Annotations["ebpf.rest.name"]
+		if rest == "" {
+			continue
+		}
+		for _, f := range ds.Fields {
+			if f.FullName == rest && f.Annotations["content-type"] == "application/x-raw-packet" && !slices.Contains(fields, rest) {
+				fields = append(fields, rest)
+			}
+		}
+	}
+	return fields
+}
+
+// isHiddenDataSource returns true if the datasource is not meant to be shown by default.
+func isHiddenDataSource(ds *api.DataSource) bool {
+	return ds.Annotations[gadgetmanager.DefaultOutputModeAnnotation] == "none"
+}
+
 func normalizeToolName(name string) string {
 	// Normalize tool name to lowercase and replace spaces with dashes
 	return "gadget_" + strings.ReplaceAll(name, " ", "_")
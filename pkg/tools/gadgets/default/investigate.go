@@ -0,0 +1,260 @@
+package _default
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/output"
+)
+
+const (
+	// InvestigationToolName is the name of the tool running several gadgets at once
+	InvestigationToolName = "ig_investigate"
+
+	// TimelineSourceField is the field telling which gadget an event of the timeline belongs to
+	TimelineSourceField = "gadget"
+
+	// maxInvestigationGadgets limits the number of gadgets run by a single investigation
+	maxInvestigationGadgets = 8
+
+	// timelineEventsFactor is how many times the timeline budget the kept events may take
+	timelineEventsFactor = 4
+)
+
+const investigationDescription = `Run several gadgets at the same time over one shared duration to correlate what happens on the system, e.g. trace_dns, trace_tcp and trace_exec to see which process resolved a name and connected to it.
+
+Returns the results of every gadget in a <gadget> block and a <timeline> of the events of all gadgets ordered by their timestamp, each tagged with the gadget it came from in the ` + TimelineSourceField + ` field. The result budget is split between the gadgets and the timeline, use fields, aggregate or dedupe per gadget to keep the results small.
+
+Gadgets take the same params as their own tool (gadget_<name>), check its input schema for the available params. The investigation can't run in background.`
+
+// investigationRun is a single gadget run of an investigation.
+type investigationRun struct {
+	label  string
+	info   *api.GadgetInfo
+	params map[string]string
+	opts   []gadgetmanager.RunOption
+
+	result string
+	err    error
+}
+
+// GetInvestigationTool returns a tool running several of the given gadgets, keyed by
+// their name, in parallel and merging their events into a single timeline.
+func GetInvestigationTool(mgr gadgetmanager.GadgetManager, infos map[string]*api.GadgetInfo) server.ServerTool {
+	names := slices.Sorted(maps.Keys(infos))
+	item := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"gadget": map[string]any{
+				"type":        "string",
+				"description": "name of the gadget to run",
+				"enum":        names,
+			},
+			"params": map[string]any{
+				"type":        "object",
+				"description": "key-value pairs of parameters to pass to the gadget, the same as for the tool of the gadget",
+			},
+			"fields":    withDescription(stringArray, "only return these fields of the gadget, prefix a field with - to drop it"),
+			"aggregate": withDescription(map[string]any{"type": "object", "properties": aggregateProperties}, "group and summarize the events of the gadget, its events are still part of the timeline"),
+			"dedupe": withDescription(map[string]any{"type": "object", "properties": map[string]any{
+				"key": withDescription(stringArray, "fields events are compared on, all fields except timestamps by default"),
+			}}, "merge identical events of the gadget, its events are still part of the timeline"),
+			"output_format": map[string]any{
+				"type":        "string",
+				"description": "encoding of the results of the gadget, the timeline is always jsonl",
+				"enum":        output.Formats,
+			},
+			"datasources": withDescription(stringArray, "only return events of these datasources of the gadget"),
+		},
+		"required": []string{"gadget"},
+	}
+
+	tool := mcp.NewTool(InvestigationToolName,
+		mcp.WithDescription(investigationDescription),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithArray("gadgets",
+			mcp.Required(),
+			mcp.Description("gadgets to run together with their params"),
+			mcp.Items(item),
+			mcp.MinItems(1),
+			mcp.MaxItems(maxInvestigationGadgets),
+		),
+		mcp.WithNumber("duration",
+			mcp.Description("Duration in seconds to run all gadgets for, defaults to 10."),
+		),
+		mcp.WithString("result_budget",
+			mcp.Description("Maximum size of the whole result in bytes (e.g. 64kb) or estimated tokens (e.g. 16000tokens), shared by the gadgets and the timeline. Defaults to the server setting."),
+		),
+	)
+	return server.ServerTool{
+		Tool:    tool,
+		Handler: investigationHandler(mgr, infos),
+	}
+}
+
+func investigationHandler(mgr gadgetmanager.GadgetManager, infos map[string]*api.GadgetInfo) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args := request.GetArguments()
+		duration := 10 * time.Second
+		if t, ok := args["duration"].(float64); ok {
+			// durations are whole seconds like for the gadget tools
+			duration = time.Duration(t) * time.Second
+			if duration <= 0 {
+				return mcp.NewToolResultError("duration must be at least 1 second, investigations can't run in background"), nil
+			}
+		}
+		budget := mgr.ResultBudget()
+		if b, ok := args["result_budget"].(string); ok {
+			var err error
+			if budget, err = output.ParseBudget(b); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+
+		runs, err := investigationRuns(args["gadgets"], infos, duration, mgr.Hosts())
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		// half of the budget is used for the timeline, the other half is shared by the gadgets
+		timelineBudget := budget
+		timelineBudget.Size = max(1, budget.Size/2)
+		gadgetBudget := budget
+		gadgetBudget.Size = max(1, budget.Size/2/len(runs))
+
+		// keep more events than fit into the budget, so that the timeline can be sampled
+		timeline := output.NewTimeline(timelineEventsFactor * timelineBudget.Bytes())
+		var wg sync.WaitGroup
+		for _, run := range runs {
+			timestamps := timestampFields(run.info)
+			sink := func(buf []byte) {
+				if err := timeline.Add(TimelineSourceField, run.label, timestamps, buf); err != nil {
+					log.Warn("Skipping event for the timeline", "gadget", run.label, "error", err)
+				}
+			}
+			// options given for the gadget take precedence over the shared ones
+			opts := append([]gadgetmanager.RunOption{gadgetmanager.WithBudget(gadgetBudget), gadgetmanager.WithSink(sink)}, run.opts...)
+			wg.Go(func() {
+				log.Debug("Running gadget", "image", run.info.ImageName, "params", run.params, "duration", duration)
+				run.result, run.err = mgr.Run(ctx, run.info.ImageName, run.params, duration, opts...)
+			})
+		}
+		wg.Wait()
+
+		res, err := investigationResults(runs, timeline, timelineBudget)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(res), nil
+	}
+}
+
+// investigationRuns validates the gadgets to run and their arguments. All problems
+// are reported at once so that no gadget is started unless all of them can be.
+func investigationRuns(arg any, infos map[string]*api.GadgetInfo, duration time.Duration, hosts []string) ([]*investigationRun, error) {
+	entries, ok := arg.([]any)
+	if !ok || len(entries) == 0 {
+		return nil, errors.New("gadgets must be a list with at least one gadget to run")
+	}
+	if len(entries) > maxInvestigationGadgets {
+		return nil, fmt.Errorf("at most %d gadgets can be run at once, got %d", maxInvestigationGadgets, len(entries))
+	}
+
+	var runs []*investigationRun
+	var problems []string
+	seen := make(map[string]int)
+	for i, entry := range entries {
+		args, ok := entry.(map[string]any)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("gadgets[%d]: expected an object, got %T", i, entry))
+			continue
+		}
+		name, _ := args["gadget"].(string)
+		info, ok := infos[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("gadgets[%d]: unknown gadget %q, must be one of: %s", i, name, strings.Join(slices.Sorted(maps.Keys(infos)), ", ")))
+			continue
+		}
+		// an early stop of one gadget would break the shared time window
+		if key := stopArg(args); key != "" {
+			problems = append(problems, fmt.Sprintf("gadgets[%d] (%s): %s is not supported, all gadgets run for the whole duration", i, name, key))
+			continue
+		}
+		p, _ := args["params"].(map[string]any)
+		params, err := runParams(info, p, duration)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("gadgets[%d] (%s): %v", i, name, err))
+			continue
+		}
+		opts, err := runOptionsFromArgs(args, info, hosts)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("gadgets[%d] (%s): %v", i, name, err))
+			continue
+		}
+
+		// tell apart several runs of the same gadget, e.g. with different params
+		label := name
+		if seen[name]++; seen[name] > 1 {
+			label = fmt.Sprintf("%s#%d", name, seen[name])
+		}
+		runs = append(runs, &investigationRun{label: label, info: info, params: params, opts: opts})
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid gadgets, none were started:\n%s", strings.Join(problems, "\n"))
+	}
+	return runs, nil
+}
+
+func stopArg(args map[string]any) string {
+	for _, key := range []string{"max_events", "stop_when"} {
+		if args[key] != nil {
+			return key
+		}
+	}
+	return ""
+}
+
+// investigationResults joins the results of all runs and the timeline of their events.
+// An error is only returned if all runs failed.
+func investigationResults(runs []*investigationRun, timeline *output.Timeline, budget output.Budget) (string, error) {
+	var res strings.Builder
+	var errs []error
+	res.WriteString("<investigation>")
+	for _, run := range runs {
+		fmt.Fprintf(&res, "\n<gadget name=%q>", run.label)
+		if run.err != nil {
+			errs = append(errs, fmt.Errorf("gadget %s: %w", run.label, run.err))
+			fmt.Fprintf(&res, "\n<error>%s</error>\n", run.err)
+		} else {
+			res.WriteString(run.result)
+		}
+		res.WriteString("</gadget>")
+	}
+	if len(errs) == len(runs) {
+		return "", fmt.Errorf("running gadgets: %w", errors.Join(errs...))
+	}
+
+	_, rows, err := output.Encode(output.FormatJSONL, timeline.Records())
+	if err != nil {
+		return "", fmt.Errorf("encoding timeline: %w", err)
+	}
+	res.WriteString("\n<timeline>")
+	fmt.Fprintf(&res, "\n<totalEvents>%d</totalEvents>", timeline.Len())
+	if dropped := timeline.Dropped(); dropped > 0 {
+		fmt.Fprintf(&res, "\n<droppedEvents>%d</droppedEvents>", dropped)
+	}
+	res.WriteString(gadgetmanager.ShapeResults("", rows, budget, true))
+	res.WriteString("</timeline>\n</investigation>\n")
+	return res.String(), nil
+}
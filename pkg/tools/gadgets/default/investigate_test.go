@@ -0,0 +1,174 @@
+package _default
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgettest"
+)
+
+// timestamped returns a gadget emitting an event with the given comm for every timestamp.
+func timestamped(image string, timestamps map[string]string) *gadgettest.Gadget {
+	g := &gadgettest.Gadget{
+		Image:    image,
+		Metadata: "name: " + image + "\n",
+		Params:   []*api.Param{{Key: "filter", Prefix: "operator.filter."}},
+		DataSources: []gadgettest.DataSource{{
+			Name: "events",
+			Fields: []gadgettest.Field{
+				// as added by the timestamp formatter
+				{Name: "timestamp", Kind: api.Kind_String, Annotations: map[string]string{"template": "timestamp"}},
+				{Name: "proc.comm", Kind: api.Kind_String},
+			},
+		}},
+	}
+	for _, comm := range slices.Sorted(maps.Keys(timestamps)) {
+		g.Events = append(g.Events, gadgettest.Event{
+			Values: map[string]any{"timestamp": timestamps[comm], "proc.comm": comm},
+		})
+	}
+	return g
+}
+
+func TestInvestigation(t *testing.T) {
+	dns := timestamped("trace_dns", map[string]string{
+		"dig":  "2025-01-01T00:00:01Z",
+		"curl": "2025-01-01T00:00:03Z",
+	})
+	tcp := timestamped("trace_tcp", map[string]string{
+		"curl": "2025-01-01T00:00:02Z",
+		"wget": "2025-01-01T00:00:04Z",
+	})
+	infos := make(map[string]*api.GadgetInfo)
+	for _, g := range []*gadgettest.Gadget{dns, tcp} {
+		info, err := g.Info()
+		if err != nil {
+			t.Fatalf("creating gadget info: %v", err)
+		}
+		infos[g.Image] = info
+	}
+	svc, err := gadgettest.NewService(t.TempDir(), "0.50.1", dns, tcp)
+	if err != nil {
+		t.Fatalf("starting service: %v", err)
+	}
+	t.Cleanup(svc.Close)
+	mgr, err := gadgetmanager.NewGadgetManager("linux", svc.Address(), nil, "")
+	if err != nil {
+		t.Fatalf("creating gadget manager: %v", err)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{
+		"gadgets": []any{
+			map[string]any{"gadget": "trace_dns"},
+			map[string]any{"gadget": "trace_tcp", "params": map[string]any{"operator.filter.filter": "proc.comm==curl"}},
+		},
+		"duration": float64(1),
+	}
+	start := time.Now()
+	res, err := GetInvestigationTool(mgr, infos).Handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("calling tool: %v", err)
+	}
+	text := resultText(t, res)
+	if res.IsError {
+		t.Fatalf("expected the investigation to succeed, got %s", text)
+	}
+	// the gadgets run at the same time
+	if elapsed := time.Since(start); elapsed >= 2*time.Second {
+		t.Errorf("expected the gadgets to run in parallel, took %v", elapsed)
+	}
+
+	for _, want := range []string{
+		"<gadget name=\"trace_dns\">\n<results>",
+		"<gadget name=\"trace_tcp\">\n<results>",
+		"<totalEvents>4</totalEvents>",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected the result to contain %q, got:\n%s", want, text)
+		}
+	}
+	timeline := text[strings.Index(text, "<timeline>"):]
+	want := `{"gadget":"trace_dns","proc.comm":"dig","timestamp":"2025-01-01T00:00:01Z"}` + "\n" +
+		`{"gadget":"trace_tcp","proc.comm":"curl","timestamp":"2025-01-01T00:00:02Z"}` + "\n" +
+		`{"gadget":"trace_dns","proc.comm":"curl","timestamp":"2025-01-01T00:00:03Z"}` + "\n" +
+		`{"gadget":"trace_tcp","proc.comm":"wget","timestamp":"2025-01-01T00:00:04Z"}` + "\n"
+	if !strings.Contains(timeline, "<results>"+want+"</results>") {
+		t.Errorf("expected the events of both gadgets ordered by time, got:\n%s", timeline)
+	}
+	if got := svc.Runs()[0].ParamValues["operator.filter.filter"] + svc.Runs()[1].ParamValues["operator.filter.filter"]; got != "proc.comm==curl" {
+		t.Errorf("expected the params to be passed to their gadget only, got %q", got)
+	}
+}
+
+func TestInvestigationInvalid(t *testing.T) {
+	info := traceExec(t)
+	infos := map[string]*api.GadgetInfo{"trace_exec": info}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{
+			name: "no gadgets",
+			args: map[string]any{"gadgets": []any{}},
+			want: "at least one gadget",
+		},
+		{
+			name: "unknown gadget",
+			args: map[string]any{"gadgets": []any{map[string]any{"gadget": "trace_exec"}, map[string]any{"gadget": "trace_open"}}},
+			want: `gadgets[1]: unknown gadget "trace_open", must be one of: trace_exec`,
+		},
+		{
+			name: "invalid params",
+			args: map[string]any{"gadgets": []any{map[string]any{"gadget": "trace_exec", "params": map[string]any{"filtr": "x"}}}},
+			want: `gadgets[0] (trace_exec): invalid params`,
+		},
+		{
+			name: "invalid arguments",
+			args: map[string]any{"gadgets": []any{map[string]any{"gadget": "trace_exec", "fields": []any{"proc.pid"}}}},
+			want: `unknown field "proc.pid"`,
+		},
+		{
+			name: "background",
+			args: map[string]any{"gadgets": []any{map[string]any{"gadget": "trace_exec"}}, "duration": float64(0)},
+			want: "can't run in background",
+		},
+		{
+			name: "early stop",
+			args: map[string]any{"gadgets": []any{map[string]any{"gadget": "trace_exec", "max_events": float64(10)}}},
+			want: "max_events is not supported",
+		},
+		{
+			name: "fraction of a second",
+			args: map[string]any{"gadgets": []any{map[string]any{"gadget": "trace_exec"}}, "duration": 0.5},
+			want: "at least 1 second",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := &gadgettest.Manager{Results: map[string]string{"trace_exec": "\n<results></results>\n"}}
+			req := mcp.CallToolRequest{}
+			req.Params.Arguments = tc.args
+			res, err := GetInvestigationTool(mgr, infos).Handler(context.Background(), req)
+			if err != nil {
+				t.Fatalf("calling tool: %v", err)
+			}
+			if text := resultText(t, res); !res.IsError || !strings.Contains(text, tc.want) {
+				t.Errorf("expected an error containing %q, got %q", tc.want, text)
+			}
+			if calls := mgr.Calls(); len(calls) != 0 {
+				t.Errorf("expected no gadget to be started, got %+v", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package _default
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/output"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/packet"
+)
+
+// runOptionsFromArgs translates the output related tool arguments into run options.
+func runOptionsFromArgs(args map[string]any, info *api.GadgetInfo, hosts []string) ([]gadgetmanager.RunOption, error) {
+	var opts []gadgetmanager.RunOption
+	if args == nil {
+		return opts, nil
+	}
+	if args["aggregate"] != nil {
+		agg, err := parseAggregation(args["aggregate"], info, hosts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregate argument: %w", err)
+		}
+		opts = append(opts, gadgetmanager.WithAggregation(agg))
+	}
+	if args["dedupe"] != nil && args["dedupe"] != false {
+		if args["aggregate"] != nil {
+			return nil, fmt.Errorf("dedupe and aggregate can't be used together")
+		}
+		dedupe, err := parseDedupe(args["dedupe"], info, hosts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dedupe argument: %w", err)
+		}
+		opts = append(opts, gadgetmanager.WithDedupe(dedupe))
+	}
+	if f, ok := args["output_format"].(string); ok {
+		format, err := output.ParseFormat(f)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gadgetmanager.WithFormat(format))
+	}
+	if args["fields"] != nil {
+		fields, err := parseFields(args["fields"], info, hosts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fields argument: %w", err)
+		}
+		opts = append(opts, gadgetmanager.WithFields(fields))
+	}
+	if args["datasources"] != nil {
+		dataSources, err := parseDataSources(args["datasources"], info)
+		if err != nil {
+			return nil, fmt.Errorf("invalid datasources argument: %w", err)
+		}
+		opts = append(opts, gadgetmanager.WithDataSources(dataSources))
+	}
+	if n, ok := args["max_events"].(float64); ok && n > 0 {
+		opts = append(opts, gadgetmanager.WithMaxEvents(int(n)))
+	}
+	if expr, ok := args["stop_when"].(string); ok && expr != "" {
+		filter, err := parseStopWhen(expr, info, hosts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stop_when argument: %w", err)
+		}
+		opts = append(opts, gadgetmanager.WithStopWhen(filter))
+	}
+	if b, ok := args["result_budget"].(string); ok {
+		budget, err := output.ParseBudget(b)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gadgetmanager.WithBudget(budget))
+	}
+	if d, ok := args["packet_decode"].(string); ok {
+		depth, err := packet.ParseDepth(d)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gadgetmanager.WithDecodeDepth(depth))
+	}
+	if args["hosts"] != nil {
+		selected, err := parseHosts(args["hosts"], hosts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hosts argument: %w", err)
+		}
+		opts = append(opts, gadgetmanager.WithHosts(selected))
+	}
+	return opts, nil
+}
+
+func parseHosts(arg any, known []string) ([]string, error) {
+	list, ok := arg.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of hosts, got %T", arg)
+	}
+	hosts := make([]string, 0, len(list))
+	for _, v := range list {
+		host, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected host to be a string, got %T", v)
+		}
+		if !slices.Contains(known, host) {
+			return nil, fmt.Errorf("unknown host %q, must be one of: %s", host, strings.Join(known, ", "))
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+func parseDataSources(arg any, info *api.GadgetInfo) ([]string, error) {
+	list, ok := arg.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of datasource names, got %T", arg)
+	}
+	var known []string
+	for _, ds := range info.DataSources {
+		known = append(known, ds.Name)
+	}
+	dataSources := make([]string, 0, len(list))
+	for _, v := range list {
+		name, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected datasource name to be a string, got %T", v)
+		}
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unknown datasource %q, must be one of: %s", name, strings.Join(known, ", "))
+		}
+		dataSources = append(dataSources, name)
+	}
+	return dataSources, nil
+}
+
+func parseFields(arg any, info *api.GadgetInfo, hosts []string) ([]string, error) {
+	list, ok := arg.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of field names, got %T", arg)
+	}
+	known := fieldNamesFromGadgetInfo(info, hosts)
+	fields := make([]string, 0, len(list))
+	for _, v := range list {
+		f, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected field name to be a string, got %T", v)
+		}
+		name := strings.TrimLeft(f, "+-")
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unknown field %q, must be one of the fields listed in the tool description", name)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func parseStopWhen(expr string, info *api.GadgetInfo, hosts []string) (*output.Filter, error) {
+	filter, err := output.ParseFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	known := fieldNamesFromGadgetInfo(info, hosts)
+	for _, f := range filter.Fields() {
+		if !slices.Contains(known, f) {
+			return nil, fmt.Errorf("unknown field %q, must be one of the fields listed in the tool description", f)
+		}
+	}
+	return filter, nil
+}
+
+func parseDedupe(arg any, info *api.GadgetInfo, hosts []string) (*output.Dedupe, error) {
+	var dedupe output.Dedupe
+	// true dedupes using the default key
+	if arg != true {
+		buf, err := json.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(buf, &dedupe); err != nil {
+			return nil, err
+		}
+		if err = dedupe.Validate(fieldNamesFromGadgetInfo(info, hosts)); err != nil {
+			return nil, err
+		}
+	}
+	dedupe.Timestamps = timestampFields(info)
+	return &dedupe, nil
+}
+
+func parseAggregation(arg any, info *api.GadgetInfo, hosts []string) (*output.Aggregation, error) {
+	// round-trip through JSON to map the generic argument onto the aggregation
+	buf, err := json.Marshal(arg)
+	if err != nil {
+		return nil, err
+	}
+	var agg output.Aggregation
+	if err = json.Unmarshal(buf, &agg); err != nil {
+		return nil, err
+	}
+	if err = agg.Validate(fieldNamesFromGadgetInfo(info, hosts)); err != nil {
+		return nil, err
+	}
+	return &agg, nil
+}
@@ -0,0 +1,130 @@
+package _default
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	progressInterval    = time.Second
+	maxProgressBatchLen = 4 * 1024 // 4kb
+)
+
+// progressNotifier forwards gadget events to the client as batched MCP progress
+// notifications while a foreground run is in progress.
+type progressNotifier struct {
+	ctx      context.Context
+	srv      *server.MCPServer
+	token    mcp.ProgressToken
+	total    float64
+	mu       sync.Mutex
+	batch    strings.Builder
+	dropped  int
+	count    int
+	reported int
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newProgressNotifier returns a notifier for the given request, or nil if the
+// caller did not supply a progress token.
+func newProgressNotifier(ctx context.Context, request mcp.CallToolRequest, duration time.Duration) *progressNotifier {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return nil
+	}
+	srv := server.ServerFromContext(ctx)
+	if srv == nil {
+		return nil
+	}
+	return &progressNotifier{
+		ctx:   ctx,
+		srv:   srv,
+		token: request.Params.Meta.ProgressToken,
+		total: duration.Seconds(),
+		done:  make(chan struct{}),
+	}
+}
+
+// Sink collects a single event, it is safe to call from multiple goroutines.
+func (p *progressNotifier) Sink(buf []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count++
+	if p.batch.Len()+len(buf)+1 > maxProgressBatchLen {
+		p.dropped++
+		return
+	}
+	p.batch.Write(buf)
+	p.batch.WriteByte('\n')
+}
+
+func (p *progressNotifier) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		start := time.Now()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				// report what was received since the last tick before the run completes
+				p.flush(time.Since(start))
+				return
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				p.flush(time.Since(start))
+			}
+		}
+	}()
+}
+
+// Stop flushes the pending events and stops sending notifications.
+func (p *progressNotifier) Stop() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+func (p *progressNotifier) flush(elapsed time.Duration) {
+	p.mu.Lock()
+	if p.count == p.reported && p.batch.Len() == 0 {
+		p.mu.Unlock()
+		return
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "%d events received so far", p.count)
+	if p.dropped > 0 {
+		fmt.Fprintf(&msg, " (%d events in this batch omitted)", p.dropped)
+	}
+	if p.batch.Len() > 0 {
+		msg.WriteString("\n")
+		msg.WriteString(p.batch.String())
+	}
+	p.reported = p.count
+	p.batch.Reset()
+	p.dropped = 0
+	p.mu.Unlock()
+
+	progress := elapsed.Seconds()
+	if p.total > 0 && progress > p.total {
+		progress = p.total
+	}
+	params := map[string]any{
+		"progressToken": p.token,
+		"progress":      progress,
+		"message":       msg.String(),
+	}
+	if p.total > 0 {
+		params["total"] = p.total
+	}
+	if err := p.srv.SendNotificationToClient(p.ctx, "notifications/progress", params); err != nil {
+		log.Debug("Failed to send progress notification", "error", err)
+	}
+}
@@ -0,0 +1,51 @@
+package _default
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type progressSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *progressSession) Initialize()       {}
+func (s *progressSession) Initialized() bool { return true }
+func (s *progressSession) SessionID() string { return "progress" }
+func (s *progressSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func TestProgressNotifierFlushesOnStop(t *testing.T) {
+	ms := server.NewMCPServer("test", "0", server.WithToolCapabilities(false))
+	ms.AddTool(mcp.NewTool("run"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		pn := newProgressNotifier(ctx, request, 10*time.Second)
+		if pn == nil {
+			return mcp.NewToolResultError("no progress notifier"), nil
+		}
+		pn.Start()
+		// the run completes before the first tick
+		pn.Sink([]byte(`{"proc":{"comm":"sh"}}`))
+		pn.Stop()
+		return mcp.NewToolResultText("done"), nil
+	})
+
+	session := &progressSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	ctx := ms.WithContext(context.Background(), session)
+	ms.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run","_meta":{"progressToken":"t"}}}`))
+
+	select {
+	case n := <-session.notifications:
+		msg, _ := n.Params.AdditionalFields["message"].(string)
+		if n.Method != "notifications/progress" || !strings.Contains(msg, `{"proc":{"comm":"sh"}}`) {
+			t.Errorf("expected the last event in a progress notification, got %s %q", n.Method, msg)
+		}
+	default:
+		t.Fatal("expected the pending events to be sent when stopping")
+	}
+}
@@ -0,0 +1,225 @@
+package _default
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	igjson "github.com/inspektor-gadget/inspektor-gadget/pkg/datasource/formatters/json"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	metadatav1 "github.com/inspektor-gadget/inspektor-gadget/pkg/metadata/v1"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+)
+
+// durationPattern matches the durations accepted by time.ParseDuration, e.g. 1m30s or 500ms
+const durationPattern = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+)$`
+
+// paramsSchema returns the JSON schema properties of the params of a gadget and the
+// keys of the mandatory ones the client has to set as they have no default.
+func paramsSchema(info *api.GadgetInfo) (map[string]any, []string) {
+	properties := make(map[string]any)
+	var required []string
+	for _, p := range info.Params {
+		key := p.Prefix + p.Key
+		properties[key] = paramSchema(p)
+		if p.IsMandatory && p.DefaultValue == "" {
+			required = append(required, key)
+		}
+	}
+	return properties, required
+}
+
+// paramSchema returns the JSON schema of a single param based on its type hint,
+// default value and possible values.
+func paramSchema(p *api.Param) map[string]any {
+	schema := map[string]any{
+		"type":        paramType(p),
+		"description": p.Description,
+	}
+	switch params.TypeHint(p.TypeHint) {
+	case params.TypeUint, params.TypeUint8, params.TypeUint16, params.TypeUint32, params.TypeUint64:
+		schema["minimum"] = 0
+	case params.TypeDuration:
+		schema["pattern"] = durationPattern
+	}
+
+	if p.DefaultValue != "" {
+		if v, err := paramValue(p, p.DefaultValue); err == nil {
+			schema["default"] = v
+		}
+	}
+
+	// only offer the possible values if all of them are valid for the type
+	var enum []any
+	for _, pv := range p.PossibleValues {
+		v, err := paramValue(p, pv)
+		if err != nil {
+			enum = nil
+			break
+		}
+		enum = append(enum, v)
+	}
+	if len(enum) > 0 {
+		schema["enum"] = enum
+	}
+	return schema
+}
+
+// paramType returns the JSON schema type of a param, params without a type hint and
+// types without a JSON counterpart like durations or IPs are strings.
+func paramType(p *api.Param) string {
+	switch params.TypeHint(p.TypeHint) {
+	case params.TypeBool:
+		return "boolean"
+	case params.TypeInt, params.TypeInt8, params.TypeInt16, params.TypeInt32, params.TypeInt64,
+		params.TypeUint, params.TypeUint8, params.TypeUint16, params.TypeUint32, params.TypeUint64:
+		return "integer"
+	case params.TypeFloat32, params.TypeFloat64:
+		return "number"
+	}
+	return "string"
+}
+
+// paramValue converts the string representation of a param value to the JSON type of
+// the param.
+func paramValue(p *api.Param, value string) (any, error) {
+	switch paramType(p) {
+	case "boolean":
+		return strconv.ParseBool(value)
+	case "integer":
+		return strconv.ParseInt(value, 10, 64)
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	}
+	return value, nil
+}
+
+// paramString converts a param value passed by the client to the string representation
+// used by the gadgets.
+func paramString(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return strconv.FormatInt(int64(v), 10), nil
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("expected a string, number or boolean, got %T", value)
+}
+
+// resultSchema returns the output schema of a gadget tool. It describes the structured
+// result, whose records hold the fields of the gadget's datasources by their full name.
+func resultSchema(info *api.GadgetInfo, hosts []string) mcp.ToolOutputSchema {
+	fields := make(map[string]any)
+	for _, ds := range info.DataSources {
+		for _, f := range ds.Fields {
+			// parent fields are flattened into their sub fields
+			if f.Kind == api.Kind_Invalid || f.Annotations[igjson.SkipFieldAnnotation] == "true" {
+				continue
+			}
+			if _, ok := fields[f.FullName]; !ok {
+				fields[f.FullName] = fieldSchema(f)
+			}
+		}
+	}
+	if len(info.DataSources) > 1 {
+		fields[gadgetmanager.DataSourceField] = map[string]any{"type": "string", "description": "datasource the event belongs to"}
+	}
+	if len(hosts) > 0 {
+		fields[gadgetmanager.HostField] = map[string]any{"type": "string", "description": "host the event was captured on"}
+	}
+	for _, f := range rawPacketFields(info) {
+		fields[f+gadgetmanager.PacketLayersSuffix] = map[string]any{"description": "decoded protocol layers of " + f}
+	}
+
+	return mcp.ToolOutputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"records": map[string]any{
+				"type":        "array",
+				"description": "Events of the gadget with their fields flattened to their full names. Deduped records additionally hold count, first_seen and last_seen, aggregated groups hold the grouped and aggregated columns instead.",
+				"items": map[string]any{
+					"type":       "object",
+					"properties": fields,
+				},
+			},
+			"truncated": map[string]any{
+				"type":        "boolean",
+				"description": "whether records were left out to fit into the result budget",
+			},
+			"totalEvents": map[string]any{
+				"type":        "integer",
+				"description": "number of events received",
+			},
+			"omittedRecords": map[string]any{
+				"type":        "integer",
+				"description": "number of records left out to fit into the result budget",
+			},
+			"duration": map[string]any{
+				"type":        "number",
+				"description": "seconds the gadget ran",
+			},
+			"stoppedEarly": map[string]any{
+				"type":        "string",
+				"description": "why the gadget was stopped before its duration elapsed",
+			},
+			"cancelled": map[string]any{
+				"type":        "boolean",
+				"description": "whether the run was cancelled",
+			},
+			"hostErrors": map[string]any{
+				"type":                 "object",
+				"description":          "errors of the hosts the gadget failed on",
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+			"instanceId": map[string]any{
+				"type":        "string",
+				"description": "ID of the gadget started in background (duration 0), its results are fetched with ig_gadgets",
+			},
+		},
+	}
+}
+
+// fieldSchema returns the JSON schema of a datasource field based on its kind and
+// annotations.
+func fieldSchema(f *api.Field) map[string]any {
+	schema := map[string]any{"type": kindType(f.Kind)}
+	// only arrays of numbers are encoded as arrays, others as hex strings
+	if itemType := kindType(f.Kind &^ api.KindFlagArray); api.IsArrayKind(f.Kind) && (itemType == "integer" || itemType == "number") {
+		schema["type"] = "array"
+		schema["items"] = map[string]any{"type": itemType}
+	}
+
+	description := f.Annotations[metadatav1.DescriptionAnnotation]
+	if values := f.Annotations[metadatav1.ValueOneOfAnnotation]; values != "" {
+		if description != "" {
+			description += ", "
+		}
+		description += "one of: " + values
+	}
+	if description != "" {
+		schema["description"] = description
+	}
+	return schema
+}
+
+// kindType returns the JSON schema type a field of the given kind is encoded as.
+func kindType(kind api.Kind) string {
+	switch kind {
+	case api.Kind_Bool:
+		return "boolean"
+	case api.Kind_Int8, api.Kind_Int16, api.Kind_Int32, api.Kind_Int64,
+		api.Kind_Uint8, api.Kind_Uint16, api.Kind_Uint32, api.Kind_Uint64:
+		return "integer"
+	case api.Kind_Float32, api.Kind_Float64:
+		return "number"
+	}
+	return "string"
+}
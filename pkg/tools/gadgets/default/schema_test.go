@@ -0,0 +1,179 @@
+package _default
+
+import (
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+)
+
+func TestParamSchema(t *testing.T) {
+	tests := []struct {
+		name  string
+		param *api.Param
+		want  map[string]any
+	}{
+		{
+			name:  "untyped",
+			param: &api.Param{Key: "filter", Description: "filter events"},
+			want:  map[string]any{"type": "string", "description": "filter events"},
+		},
+		{
+			name:  "bool",
+			param: &api.Param{Key: "verbose", TypeHint: "bool", DefaultValue: "false"},
+			want:  map[string]any{"type": "boolean", "description": "", "default": false},
+		},
+		{
+			name:  "uint",
+			param: &api.Param{Key: "max-entries", TypeHint: "uint32", DefaultValue: "20"},
+			want:  map[string]any{"type": "integer", "description": "", "default": int64(20), "minimum": 0},
+		},
+		{
+			name:  "duration",
+			param: &api.Param{Key: "interval", TypeHint: "duration", DefaultValue: "1s"},
+			want:  map[string]any{"type": "string", "description": "", "default": "1s", "pattern": durationPattern},
+		},
+		{
+			name:  "possible values",
+			param: &api.Param{Key: "sort", PossibleValues: []string{"asc", "desc"}, DefaultValue: "asc"},
+			want:  map[string]any{"type": "string", "description": "", "default": "asc", "enum": []any{"asc", "desc"}},
+		},
+		{
+			name:  "typed possible values",
+			param: &api.Param{Key: "level", TypeHint: "int", PossibleValues: []string{"1", "2"}},
+			want:  map[string]any{"type": "integer", "description": "", "enum": []any{int64(1), int64(2)}},
+		},
+		{
+			name:  "invalid default",
+			param: &api.Param{Key: "count", TypeHint: "int", DefaultValue: "many"},
+			want:  map[string]any{"type": "integer", "description": ""},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := paramSchema(tc.param); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParamsSchemaRequired(t *testing.T) {
+	info := &api.GadgetInfo{Params: []*api.Param{
+		{Key: "namespace", Prefix: "operator.KubeManager.", IsMandatory: true},
+		{Key: "interval", IsMandatory: true, DefaultValue: "1s"},
+		{Key: "filter"},
+	}}
+	properties, required := paramsSchema(info)
+	if len(properties) != 3 {
+		t.Errorf("expected 3 properties, got %d", len(properties))
+	}
+	if want := []string{"operator.KubeManager.namespace"}; !reflect.DeepEqual(required, want) {
+		t.Errorf("expected mandatory params without default %v to be required, got %v", want, required)
+	}
+}
+
+func TestDurationPattern(t *testing.T) {
+	re := regexp.MustCompile(durationPattern)
+	for _, d := range []string{"0", "1s", "1.5h", "1m30s", "500ms", "10us", "-2s", ".5s", "s", "1", "1d", "1s ", ""} {
+		_, err := time.ParseDuration(d)
+		if valid := err == nil; re.MatchString(d) != valid {
+			t.Errorf("expected the pattern to match %q: %v", d, valid)
+		}
+	}
+}
+
+func TestParamString(t *testing.T) {
+	tests := []struct {
+		value   any
+		want    string
+		wantErr bool
+	}{
+		{value: "error!=0", want: "error!=0"},
+		{value: true, want: "true"},
+		{value: float64(20), want: "20"},
+		{value: 0.5, want: "0.5"},
+		{value: []any{"a"}, wantErr: true},
+		{value: nil, wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := paramString(tc.value)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("paramString(%v): expected %q (error %v), got %q (%v)", tc.value, tc.want, tc.wantErr, got, err)
+		}
+	}
+}
+
+func TestFieldSchema(t *testing.T) {
+	tests := []struct {
+		name  string
+		field *api.Field
+		want  map[string]any
+	}{
+		{
+			name:  "string",
+			field: &api.Field{FullName: "proc.comm", Kind: api.Kind_CString, Annotations: map[string]string{"description": "command name"}},
+			want:  map[string]any{"type": "string", "description": "command name"},
+		},
+		{
+			name:  "unsigned",
+			field: &api.Field{FullName: "proc.pid", Kind: api.Kind_Uint32},
+			want:  map[string]any{"type": "integer"},
+		},
+		{
+			name:  "bool",
+			field: &api.Field{FullName: "qr", Kind: api.Kind_Bool},
+			want:  map[string]any{"type": "boolean"},
+		},
+		{
+			name:  "float array",
+			field: &api.Field{FullName: "latencies", Kind: api.ArrayOf(api.Kind_Float64)},
+			want:  map[string]any{"type": "array", "items": map[string]any{"type": "number"}},
+		},
+		{
+			name:  "bytes",
+			field: &api.Field{FullName: "data", Kind: api.Kind_Bytes},
+			want:  map[string]any{"type": "string"},
+		},
+		{
+			name:  "possible values",
+			field: &api.Field{FullName: "type", Kind: api.Kind_String, Annotations: map[string]string{"description": "event type", "value.one-of": "A, B"}},
+			want:  map[string]any{"type": "string", "description": "event type, one of: A, B"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := fieldSchema(tc.field); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestResultSchema(t *testing.T) {
+	info := &api.GadgetInfo{DataSources: []*api.DataSource{
+		{Name: "exec", Fields: []*api.Field{
+			{FullName: "proc", Kind: api.Kind_Invalid},
+			{FullName: "proc.comm", Kind: api.Kind_String},
+			{FullName: "proc.raw", Kind: api.Kind_Bytes, Annotations: map[string]string{"json.skip": "true"}},
+		}},
+		{Name: "exit", Fields: []*api.Field{{FullName: "proc.comm", Kind: api.Kind_String}}},
+	}}
+	schema := resultSchema(info, []string{"a", "b"})
+	if schema.Type != "object" {
+		t.Errorf("expected an object schema, got %q", schema.Type)
+	}
+	records := schema.Properties["records"].(map[string]any)
+	fields := records["items"].(map[string]any)["properties"].(map[string]any)
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if want := []string{"datasource", "host", "proc.comm"}; !slices.Equal(names, want) {
+		t.Errorf("expected the record fields %v, got %v", want, names)
+	}
+}
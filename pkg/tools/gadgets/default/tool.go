@@ -5,6 +5,7 @@ import (
 	"context"
 	"embed"
 	"fmt"
+	"maps"
 	"sync"
 	"text/template"
 	"time"
@@ -19,6 +20,8 @@ import (
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/cache"
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/discoverer"
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/output"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/packet"
 )
 
 //go:embed templates
@@ -30,7 +33,9 @@ type gadgetInfoResult struct {
 	err  error
 }
 
-func GetTools(ctx context.Context, mgr gadgetmanager.GadgetManager, env string, gadgets []discoverer.Gadget) []server.ServerTool {
+// GetGadgetInfos fetches the info of the given gadgets, keyed by the image it was
+// fetched for. Infos are cached per Inspektor Gadget version and environment.
+func GetGadgetInfos(ctx context.Context, mgr gadgetmanager.GadgetManager, env string, gadgets []discoverer.Gadget) map[string]*api.GadgetInfo {
 	// load cache
 	version, err := mgr.GetVersion()
 	if err != nil {
@@ -44,9 +49,7 @@ func GetTools(ctx context.Context, mgr gadgetmanager.GadgetManager, env string,
 		log.Info("Fetching gadget information without cache. Initial load may take several seconds.")
 	}
 
-	// prepare tools
 	gadgetInfos := fetchGadgetInfosConcurrently(ctx, mgr, gadgets, cachedInfos)
-	tools := buildToolsFromGadgetInfos(env, mgr, gadgetInfos)
 
 	// save cache if needed
 	if len(cachedInfos) != len(gadgetInfos) {
@@ -56,7 +59,7 @@ func GetTools(ctx context.Context, mgr gadgetmanager.GadgetManager, env string,
 		}
 	}
 
-	return tools
+	return gadgetInfos
 }
 
 func fetchGadgetInfosConcurrently(ctx context.Context, mgr gadgetmanager.GadgetManager, gadgets []discoverer.Gadget, cachedInfos map[string]*api.GadgetInfo) map[string]*api.GadgetInfo {
@@ -148,11 +151,12 @@ func fetchGadgetInfoWithRetries(ctx context.Context, mgr gadgetmanager.GadgetMan
 	return nil, fmt.Errorf("failed to get gadget info after %d attempts", maxRetries)
 }
 
-func buildToolsFromGadgetInfos(env string, mgr gadgetmanager.GadgetManager, gadgetInfos map[string]*api.GadgetInfo) []server.ServerTool {
+// GetTools returns one tool per gadget info.
+func GetTools(env string, mgr gadgetmanager.GadgetManager, gadgetInfos map[string]*api.GadgetInfo) []server.ServerTool {
 	var tools []server.ServerTool
 
 	for image, info := range gadgetInfos {
-		tool, err := gadgetsTool(env, info)
+		tool, err := gadgetsTool(env, info, mgr.Hosts())
 		if err != nil {
 			log.Warn("Skipping gadget due to error creating tool", "image", image, "error", err)
 			continue
@@ -169,53 +173,59 @@ func buildToolsFromGadgetInfos(env string, mgr gadgetmanager.GadgetManager, gadg
 	return tools
 }
 
-func gadgetsTool(env string, info *api.GadgetInfo) (mcp.Tool, error) {
+func gadgetsTool(env string, info *api.GadgetInfo, hosts []string) (mcp.Tool, error) {
 	var metadata metadatav1.GadgetMetadata
 	err := yaml.Unmarshal(info.Metadata, &metadata)
 	if err != nil {
 		return mcp.Tool{}, fmt.Errorf("unmarshalling gadget metadata: %w", err)
 	}
 
-	description, err := generateToolDescription(env, &metadata, info)
+	description, err := generateToolDescription(env, &metadata, info, hosts)
 	if err != nil {
 		return mcp.Tool{}, fmt.Errorf("generating tool description: %w", err)
 	}
 
-	toolParams := make(map[string]interface{})
-	for _, p := range info.Params {
-		toolParams[p.Prefix+p.Key] = map[string]interface{}{
-			"type":        "string",
-			"description": p.Description,
-		}
+	toolParams, requiredParams := paramsSchema(info)
+
+	var dataSources []string
+	for _, ds := range info.DataSources {
+		dataSources = append(dataSources, ds.Name)
 	}
 
-	tool := createMCPTool(metadata.Name, description, toolParams)
+	tool := createMCPTool(metadata.Name, description, toolParams, requiredParams, dataSources, hosts, len(rawPacketFields(info)) > 0)
+	tool.OutputSchema = resultSchema(info, hosts)
 
 	return tool, nil
 }
 
-func generateToolDescription(env string, metadata *metadatav1.GadgetMetadata, info *api.GadgetInfo) (string, error) {
+func generateToolDescription(env string, metadata *metadatav1.GadgetMetadata, info *api.GadgetInfo, hosts []string) (string, error) {
 	tmpl, err := template.ParseFS(templates, "templates/toolDescription.tmpl")
 	if err != nil {
 		return "", fmt.Errorf("parsing template: %w", err)
 	}
 
-	var fields []FieldData
-	// TODO: Support multiple data sources
-	if len(info.DataSources) > 0 {
-		for _, field := range info.DataSources[0].Fields {
-			fields = append(fields, FieldData{
+	var dataSources []DataSourceData
+	for _, ds := range info.DataSources {
+		dsData := DataSourceData{
+			Name:   ds.Name,
+			Hidden: isHiddenDataSource(ds),
+		}
+		for _, field := range ds.Fields {
+			dsData.Fields = append(dsData.Fields, FieldData{
 				Name:           field.FullName,
 				Description:    field.Annotations[metadatav1.DescriptionAnnotation],
 				PossibleValues: field.Annotations[metadatav1.ValueOneOfAnnotation],
 			})
 		}
+		dataSources = append(dataSources, dsData)
 	}
 	toolData := ToolData{
-		Name:        normalizeToolName(metadata.Name),
-		Description: metadata.Description,
-		Environment: env,
-		Fields:      fields,
+		Name:         normalizeToolName(metadata.Name),
+		Description:  metadata.Description,
+		Environment:  env,
+		DataSources:  dataSources,
+		Hosts:        hosts,
+		PacketFields: rawPacketFields(info),
 	}
 
 	var out bytes.Buffer
@@ -226,7 +236,48 @@ func generateToolDescription(env string, metadata *metadatav1.GadgetMetadata, in
 	return out.String(), nil
 }
 
-func createMCPTool(name, description string, params map[string]interface{}) mcp.Tool {
+var stringArray = map[string]any{
+	"type":  "array",
+	"items": map[string]any{"type": "string"},
+}
+
+var aggregateProperties = map[string]any{
+	"group_by": withDescription(stringArray, "fields to group events by"),
+	"sum":      withDescription(stringArray, "numeric fields to sum up per group"),
+	"min":      withDescription(stringArray, "fields to get the minimum value of per group"),
+	"max":      withDescription(stringArray, "fields to get the maximum value of per group"),
+	"avg":      withDescription(stringArray, "numeric fields to average per group"),
+	"order_by": map[string]any{
+		"type":        "string",
+		"description": "column to sort groups by, e.g. count (default) or sum(field)",
+	},
+	"order": map[string]any{
+		"type":        "string",
+		"enum":        []string{"desc", "asc"},
+		"description": "direction to sort groups in, desc (default) or asc",
+	},
+	"top": map[string]any{
+		"type":        "integer",
+		"description": "only return the first N groups",
+	},
+}
+
+func withDescription(schema map[string]any, description string) map[string]any {
+	s := maps.Clone(schema)
+	s["description"] = description
+	return s
+}
+
+// requiredProperties marks the given properties of an object as required.
+func requiredProperties(required []string) mcp.PropertyOption {
+	return func(schema map[string]any) {
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	}
+}
+
+func createMCPTool(name, description string, params map[string]interface{}, requiredParams []string, dataSources []string, hosts []string, rawPackets bool) mcp.Tool {
 	opts := []mcp.ToolOption{
 		mcp.WithDescription(description),
 		mcp.WithReadOnlyHintAnnotation(true),
@@ -234,10 +285,58 @@ func createMCPTool(name, description string, params map[string]interface{}) mcp.
 			mcp.Required(),
 			mcp.Description("key-value pairs of parameters to pass to the gadget"),
 			mcp.Properties(params),
+			requiredProperties(requiredParams),
 		),
 		mcp.WithNumber("duration",
 			mcp.Description("Duration in seconds to run the gadget. Use 0 to run in background/continuously."),
 		),
+		mcp.WithNumber("max_events",
+			mcp.Description("Stop the gadget as soon as this many events were received, duration is then only an upper bound. Not available in background mode."),
+		),
+		mcp.WithString("stop_when",
+			mcp.Description("Stop the gadget as soon as an event matching this filter was received, e.g. 'proc.comm==curl' or 'k8s.podName~^nginx,error!=0'. Uses the syntax of operator.filter.filter, duration is then only an upper bound. Not available in background mode."),
+		),
+		mcp.WithObject("aggregate",
+			mcp.Description("Group and summarize events on the server instead of returning them one by one. Not available in background mode."),
+			mcp.Properties(aggregateProperties),
+		),
+		mcp.WithObject("dedupe",
+			mcp.Description("Merge identical events into one with count, first_seen and last_seen fields. Pass {} to compare all fields except timestamps, or a key to only compare some fields. Not available in background mode or together with aggregate."),
+			mcp.Properties(map[string]any{
+				"key": withDescription(stringArray, "fields events are compared on, all fields except timestamps by default"),
+			}),
+		),
+		mcp.WithArray("fields",
+			mcp.Description("Only return these fields (full names as listed in the tool description), selecting a parent field like k8s selects all its sub fields. Prefix a field with - to drop it and keep all others. Use it to remove noisy fields and stay within the output size limit."),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("output_format",
+			mcp.Description("Encoding of the results: jsonl (default, one JSON object per event), csv (single header row) or table (aligned text table). csv and table use fewer tokens."),
+			mcp.Enum(output.Formats...),
+		),
+		mcp.WithString("result_budget",
+			mcp.Description("Maximum size of the results in bytes (e.g. 32kb) or estimated tokens (e.g. 8000tokens). If the events don't fit, a sample of the first, last and evenly spaced events in between is returned. Defaults to the server setting."),
+		),
+	}
+
+	// only offer to select datasources if there is a choice
+	if len(dataSources) > 1 {
+		opts = append(opts, mcp.WithArray("datasources",
+			mcp.Description("Only return events of these datasources, by default all datasources listed in the tool description as included by default are returned"),
+			mcp.WithStringEnumItems(dataSources),
+		))
+	}
+	if rawPackets {
+		opts = append(opts, mcp.WithString("packet_decode",
+			mcp.Description("Protocol layer up to which raw packets are decoded into the layers field: none, link (ethernet), network (ip), transport (tcp/udp) or application (dns/http, default). Use a lower depth to save tokens."),
+			mcp.Enum(packet.Depths...),
+		))
+	}
+	if len(hosts) > 1 {
+		opts = append(opts, mcp.WithArray("hosts",
+			mcp.Description("Only run the gadget on these hosts, by default it runs on all of them."),
+			mcp.WithStringEnumItems(hosts),
+		))
 	}
 
 	return mcp.NewTool(normalizeToolName(name), opts...)
@@ -0,0 +1,145 @@
+package _default
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	apihelpers "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api-helpers"
+)
+
+// validateParams checks the params passed by the client against the params of the gadget
+// and returns them as strings. Every problem found is listed in the returned error
+// together with how to fix it.
+func validateParams(info *api.GadgetInfo, values map[string]any) (map[string]string, error) {
+	known := make(map[string]*api.Param)
+	for _, p := range info.Params {
+		known[p.Prefix+p.Key] = p
+		if p.AlternativeKey != "" {
+			known[p.Prefix+p.AlternativeKey] = p
+		}
+	}
+
+	params := make(map[string]string, len(values))
+	var problems []string
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		p, ok := known[key]
+		if !ok {
+			msg := fmt.Sprintf("unknown param %q", key)
+			if suggestion := suggestParam(key, slices.Sorted(maps.Keys(known))); suggestion != "" {
+				msg += fmt.Sprintf(", did you mean %q?", suggestion)
+			}
+			problems = append(problems, msg)
+			continue
+		}
+		value, err := validateParam(p, values[key])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("param %q: %v", key, err))
+			continue
+		}
+		params[p.Prefix+p.Key] = value
+	}
+	for _, p := range info.Params {
+		key := p.Prefix + p.Key
+		if _, ok := params[key]; !ok && p.IsMandatory && p.DefaultValue == "" {
+			problems = append(problems, fmt.Sprintf("missing mandatory param %q", key))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid params:\n- %s\nOnly use the params listed in the input schema of the gadget with values of the given type", strings.Join(problems, "\n- "))
+	}
+	return params, nil
+}
+
+// validateParam checks the type and value of a single param and returns its string
+// representation. Typed params can be passed as their JSON type or as a string.
+func validateParam(p *api.Param, value any) (string, error) {
+	typ := paramType(p)
+	switch v := value.(type) {
+	case string:
+	case bool:
+		if typ != "boolean" {
+			return "", fmt.Errorf("expected a %s, got a boolean", typ)
+		}
+	case float64:
+		if typ == "integer" && v != float64(int64(v)) {
+			return "", fmt.Errorf("expected an integer, got %v", v)
+		}
+		if typ != "integer" && typ != "number" {
+			return "", fmt.Errorf("expected a %s, got a number", typ)
+		}
+	}
+	s, err := paramString(value)
+	if err != nil {
+		return "", err
+	}
+
+	if s == "" {
+		if p.IsMandatory {
+			return "", errors.New("a value is required")
+		}
+		return s, nil
+	}
+	if len(p.PossibleValues) > 0 && !slices.Contains(p.PossibleValues, s) {
+		return "", fmt.Errorf("invalid value %q, must be one of: %s", s, strings.Join(p.PossibleValues, ", "))
+	}
+	desc := apihelpers.ParamToParamDesc(p)
+	if err := desc.Validate(s); err != nil {
+		return "", fmt.Errorf("invalid value %q, expected a value of type %s", s, desc.Type())
+	}
+	return s, nil
+}
+
+// suggestParam returns the known param closest to the given unknown one or an empty
+// string if none is close enough.
+func suggestParam(key string, known []string) string {
+	// the prefix is often left out, e.g. namespace for operator.KubeManager.namespace
+	for _, k := range known {
+		if strings.HasSuffix(k, "."+key) {
+			return k
+		}
+	}
+
+	best, bestDist := "", -1
+	lower := strings.ToLower(key)
+	for _, k := range known {
+		candidate := strings.ToLower(k)
+		// compare the keys without their prefix unless one was given
+		if !strings.Contains(lower, ".") {
+			candidate = candidate[strings.LastIndex(candidate, ".")+1:]
+		}
+		d := levenshtein(lower, candidate)
+		if d > max(2, len(candidate)/4) {
+			continue
+		}
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
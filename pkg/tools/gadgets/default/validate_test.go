@@ -0,0 +1,99 @@
+package _default
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+)
+
+func TestValidateParams(t *testing.T) {
+	info := &api.GadgetInfo{Params: []*api.Param{
+		{Key: "namespace", Prefix: "operator.KubeManager."},
+		{Key: "filter", Prefix: "operator.filter."},
+		{Key: "max-entries", TypeHint: "uint32"},
+		{Key: "verbose", TypeHint: "bool"},
+		{Key: "interval", TypeHint: "duration", DefaultValue: "1s"},
+		{Key: "sort", PossibleValues: []string{"asc", "desc"}},
+		{Key: "target", IsMandatory: true, DefaultValue: "all"},
+	}}
+
+	tests := []struct {
+		name   string
+		values map[string]any
+		want   map[string]string
+		// wantErr holds the parts of the expected error
+		wantErr []string
+	}{
+		{
+			name:   "typed values",
+			values: map[string]any{"max-entries": float64(10), "verbose": true, "interval": "5s", "sort": "desc"},
+			want:   map[string]string{"max-entries": "10", "verbose": "true", "interval": "5s", "sort": "desc"},
+		},
+		{
+			name:   "typed values as strings",
+			values: map[string]any{"max-entries": "10", "verbose": "false"},
+			want:   map[string]string{"max-entries": "10", "verbose": "false"},
+		},
+		{
+			name:    "unknown param without prefix",
+			values:  map[string]any{"namespace": "default"},
+			wantErr: []string{`unknown param "namespace"`, `did you mean "operator.KubeManager.namespace"?`},
+		},
+		{
+			name:    "misspelled param",
+			values:  map[string]any{"operator.filter.filtre": "error!=0"},
+			wantErr: []string{`did you mean "operator.filter.filter"?`},
+		},
+		{
+			name:    "unknown param without suggestion",
+			values:  map[string]any{"pid": "1"},
+			wantErr: []string{`unknown param "pid"`},
+		},
+		{
+			name:    "wrong type",
+			values:  map[string]any{"verbose": float64(1), "sort": true},
+			wantErr: []string{`param "verbose": expected a boolean, got a number`, `param "sort": expected a string, got a boolean`},
+		},
+		{
+			name:    "invalid values",
+			values:  map[string]any{"max-entries": "-1", "interval": "5", "sort": "up"},
+			wantErr: []string{`invalid value "-1", expected a value of type uint32`, `invalid value "5", expected a value of type duration`, `invalid value "up", must be one of: asc, desc`},
+		},
+		{
+			name:    "empty mandatory param",
+			values:  map[string]any{"target": ""},
+			wantErr: []string{`param "target": a value is required`},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := validateParams(info, tc.values)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("expected %v, got %v", tc.want, got)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error, got %v", got)
+			}
+			for _, part := range tc.wantErr {
+				if !strings.Contains(err.Error(), part) {
+					t.Errorf("expected the error to contain %q, got %q", part, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateParamsMissingMandatory(t *testing.T) {
+	info := &api.GadgetInfo{Params: []*api.Param{{Key: "target", Prefix: "operator.x.", IsMandatory: true}}}
+	if _, err := validateParams(info, nil); err == nil || !strings.Contains(err.Error(), `missing mandatory param "operator.x.target"`) {
+		t.Errorf("expected the missing mandatory param to be reported, got %v", err)
+	}
+}
@@ -10,11 +10,14 @@ import (
 
 var log = slog.Default().With("component", "ephemeral_tool")
 
-func ephemeralHandler() server.ToolHandlerFunc {
+func ephemeralHandler(env string) server.ToolHandlerFunc {
+	msg := "Inspektor Gadget is not deployed, please deploy it using the ig_deploy tool first. " +
+		"The tool list is refreshed automatically once the gadget pods are ready."
+	if env == "linux" {
+		msg = "The ig daemon is not reachable, please make sure it is running (e.g. using 'ig daemon'). " +
+			"The tool list is refreshed automatically once it is reachable."
+	}
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return mcp.NewToolResultError(
-			"Inspektor Gadget is not deployed, please deploy it using the ig_deploy tool first" +
-				"or if you just deployed it, please restart the ig-mcp-server or MCP gateway to refresh the tool list",
-		), nil
+		return mcp.NewToolResultError(msg), nil
 	}
 }
@@ -1,17 +1,17 @@
 package ephemeral
 
 import (
-	"fmt"
 	"strings"
 
-	"github.com/distribution/reference"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/discoverer"
 )
 
-func GetTools(gadgets []discoverer.Gadget) []server.ServerTool {
+// GetTools returns placeholder tools for the given gadgets to use until Inspektor
+// Gadget is available in the environment.
+func GetTools(env string, gadgets []discoverer.Gadget) []server.ServerTool {
 	var tools []server.ServerTool
 	for _, g := range gadgets {
 		n, err := extractNameFrom(g.Image)
@@ -23,26 +23,24 @@ func GetTools(gadgets []discoverer.Gadget) []server.ServerTool {
 		t := mcp.NewTool(
 			"gadget_"+n,
 			mcp.WithDescription(g.Description),
+			// like the gadget tools they stand in for, so they're kept in read-only mode
+			mcp.WithReadOnlyHintAnnotation(true),
 		)
 
 		tools = append(tools, server.ServerTool{
 			Tool:    t,
-			Handler: ephemeralHandler(),
+			Handler: ephemeralHandler(env),
 		})
 	}
 	return tools
 }
 
 func extractNameFrom(image string) (string, error) {
-	ref, err := reference.ParseNormalizedNamed(image)
+	name, err := discoverer.GadgetName(image)
 	if err != nil {
-		return "", fmt.Errorf("parsing image reference %s: %w", image, err)
+		return "", err
 	}
-	parts := strings.Split(reference.TrimNamed(ref).Name(), "/")
-	if len(parts) == 0 {
-		return "", fmt.Errorf("invalid image reference: %s", image)
-	}
-	return normalizeToolName(parts[len(parts)-1]), nil
+	return normalizeToolName(name), nil
 }
 
 func normalizeToolName(name string) string {
@@ -3,6 +3,8 @@ package gadgets
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"slices"
 	"strings"
@@ -34,7 +36,7 @@ func lifecycleHandler(mgr gadgetmanager.GadgetManager) server.ToolHandlerFunc {
 		case actionListGadgets:
 			return handleListGadgets(ctx, mgr)
 		case actionGetResults:
-			return handleGetGadgetResults(ctx, mgr, gadgetID)
+			return handleGetGadgetResults(ctx, mgr, gadgetID, request.GetString("cursor", ""), request.GetInt("limit", 0))
 		case actionStopGadget:
 			return handleStopGadget(ctx, mgr, gadgetID)
 		}
@@ -46,11 +48,13 @@ func lifecycleHandler(mgr gadgetmanager.GadgetManager) server.ToolHandlerFunc {
 func handleListGadgets(ctx context.Context, mgr gadgetmanager.GadgetManager) (*mcp.CallToolResult, error) {
 	log.Debug("Listing gadgets")
 	gadgets, err := mgr.ListGadgets(ctx)
-	if err != nil {
+	// some hosts being unreachable is reported along with the gadgets of the others
+	var hostErrs gadgetmanager.HostErrors
+	if err != nil && !errors.As(err, &hostErrs) {
 		return mcp.NewToolResultError("Failed to list gadgets: " + err.Error()), nil
 	}
 	if len(gadgets) == 0 {
-		return mcp.NewToolResultText("No running gadgets found"), nil
+		return mcp.NewToolResultText("No running gadgets found" + hostErrs.String()), nil
 	}
 
 	JSONData, err := json.Marshal(gadgets)
@@ -58,21 +62,40 @@ func handleListGadgets(ctx context.Context, mgr gadgetmanager.GadgetManager) (*m
 		return mcp.NewToolResultError("Failed to marshal gadgets to JSON: " + err.Error()), nil
 	}
 
-	return mcp.NewToolResultText(string(JSONData)), nil
+	return mcp.NewToolResultText(string(JSONData) + hostErrs.String()), nil
 }
 
-func handleGetGadgetResults(_ context.Context, mgr gadgetmanager.GadgetManager, gadgetID string) (*mcp.CallToolResult, error) {
-	log.Debug("Getting gadget results", "gadget_id", gadgetID)
-	result, err := mgr.GetResults(gadgetID)
+func handleGetGadgetResults(ctx context.Context, mgr gadgetmanager.GadgetManager, gadgetID string, cursor string, limit int) (*mcp.CallToolResult, error) {
+	log.Debug("Getting gadget results", "gadget_id", gadgetID, "cursor", cursor, "limit", limit)
+	page, err := mgr.GetResults(ctx, gadgetID, cursor, limit)
 	if err != nil {
 		return mcp.NewToolResultError("Failed to get gadget results: " + err.Error()), nil
 	}
-	return mcp.NewToolResultText(result), nil
+
+	var sb strings.Builder
+	sb.WriteString(page.Results)
+	if page.Skipped > 0 {
+		fmt.Fprintf(&sb, "<skippedEvents>%d</skippedEvents>\n", page.Skipped)
+	}
+	fmt.Fprintf(&sb, "<eventCount>%d</eventCount>\n", page.Count)
+	fmt.Fprintf(&sb, "<next_cursor>%s</next_cursor>\n", page.NextCursor)
+	if page.Completed {
+		sb.WriteString("<completed>true</completed>\n")
+	}
+	if page.Capture != "" {
+		sb.WriteString(strings.TrimPrefix(page.Capture, "\n"))
+		sb.WriteByte('\n')
+	}
+	if len(page.HostErrors) > 0 {
+		sb.WriteString(strings.TrimPrefix(page.HostErrors.String(), "\n"))
+		sb.WriteByte('\n')
+	}
+	return mcp.NewToolResultText(sb.String()), nil
 }
 
-func handleStopGadget(_ context.Context, mgr gadgetmanager.GadgetManager, gadgetID string) (*mcp.CallToolResult, error) {
+func handleStopGadget(ctx context.Context, mgr gadgetmanager.GadgetManager, gadgetID string) (*mcp.CallToolResult, error) {
 	log.Debug("Stopping gadget", "gadget_id", gadgetID)
-	err := mgr.Stop(gadgetID)
+	err := mgr.Stop(ctx, gadgetID)
 	if err != nil {
 		return mcp.NewToolResultError("Failed to stop gadget: " + err.Error()), nil
 	}
@@ -1,6 +1,8 @@
 package gadgets
 
 import (
+	"fmt"
+
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 
@@ -23,9 +25,11 @@ func lifecycleTool() mcp.Tool {
 			mcp.Description("Lifecycle action to perform: "+
 				actionListGadgets+"(list running gadgets), "+
 				actionStopGadget+"(stop a running gadget using its ID), "+
-				actionGetResults+"(get results of a running gadget using its ID, only available before stopping it)"),
+				actionGetResults+"(get results of a running gadget using its ID page by page, only available before stopping it)"),
 			mcp.Enum(gadgetActions...),
 		),
 		mcp.WithString("gadget_id", mcp.Description("ID of the gadget to stop or get results from, required for "+actionStopGadget+" and "+actionGetResults)),
+		mcp.WithString("cursor", mcp.Description("Cursor to continue reading results from, use the next_cursor value returned by the previous "+actionGetResults+" call. Omit to start with the oldest stored event")),
+		mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum number of events to return for %s (default %d, max %d)", actionGetResults, gadgetmanager.DefaultPageLimit, gadgetmanager.MaxPageLimit))),
 	)
 }
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/policy"
+	gadgetsdefault "github.com/inspektor-gadget/ig-mcp-server/pkg/tools/gadgets/default"
+)
+
+const (
+	// gadgetToolPrefix is the prefix of the tools running a single gadget
+	gadgetToolPrefix = "gadget_"
+
+	// defaultDuration is the duration gadgets run for if the client doesn't set one
+	defaultDuration = 10 * time.Second
+)
+
+// WithPolicy checks all tool calls against the given policy.
+func WithPolicy(p *policy.Policy) Option {
+	return func(r *GadgetToolRegistry) {
+		r.policy.Store(p)
+	}
+}
+
+// SetPolicy replaces the policy tool calls are checked against, e.g. after it was
+// reloaded. Clients are notified as the tools offered to them might have changed.
+func (r *GadgetToolRegistry) SetPolicy(p *policy.Policy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy.Store(p)
+	if r.prepared {
+		r.notify()
+	}
+}
+
+// enforcePolicy wraps the handlers of the tools to check their calls against the
+// policy in place at the time of the call.
+func (r *GadgetToolRegistry) enforcePolicy(tools ...server.ServerTool) []server.ServerTool {
+	wrapped := make([]server.ServerTool, 0, len(tools))
+	for _, tool := range tools {
+		name, handler := tool.Tool.Name, tool.Handler
+		tool.Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if err := r.checkPolicy(name, request.GetArguments()); err != nil {
+				log.Warn("Blocked tool call", "tool", name, "error", err)
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return handler(ctx, request)
+		}
+		wrapped = append(wrapped, tool)
+	}
+	return wrapped
+}
+
+// checkPolicy returns a policy.Violation if the policy doesn't allow the call of a tool.
+func (r *GadgetToolRegistry) checkPolicy(name string, args map[string]any) error {
+	p := r.policy.Load()
+	if p == nil {
+		return nil
+	}
+
+	switch {
+	case name == gadgetsdefault.InvestigationToolName:
+		if err := p.Check(policy.Call{Tool: name}); err != nil {
+			return err
+		}
+		duration := defaultDuration
+		if t, ok := args["duration"].(float64); ok {
+			duration = time.Duration(t) * time.Second
+		}
+		// the gadgets of an investigation are subject to the same rules as their tools
+		entries, _ := args["gadgets"].([]any)
+		for _, entry := range entries {
+			gadgetArgs, _ := entry.(map[string]any)
+			gadget, _ := gadgetArgs["gadget"].(string)
+			if err := p.Check(r.gadgetCall(gadget, gadgetArgs, duration)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case strings.HasPrefix(name, gadgetToolPrefix):
+		duration := defaultDuration
+		if t, ok := args["duration"].(float64); ok {
+			duration = time.Duration(t) * time.Second
+		}
+		return p.Check(r.gadgetCall(strings.TrimPrefix(name, gadgetToolPrefix), args, duration))
+	}
+	action, _ := args["action"].(string)
+	return p.Check(policy.Call{Tool: name, Action: action})
+}
+
+// gadgetCall describes a run of a gadget. Params set by their alternative key are
+// reported by their key, so that they can't be used to get around the policy.
+func (r *GadgetToolRegistry) gadgetCall(gadget string, args map[string]any, duration time.Duration) policy.Call {
+	values, _ := args["params"].(map[string]any)
+	params := slices.Sorted(maps.Keys(values))
+	if info, err := r.GadgetInfo(gadget); err == nil {
+		params = canonicalParams(info, params)
+	}
+	return policy.Call{Tool: gadgetToolPrefix + gadget, Duration: &duration, Params: params}
+}
+
+func canonicalParams(info *api.GadgetInfo, keys []string) []string {
+	canonical := make(map[string]string)
+	for _, p := range info.Params {
+		if p.AlternativeKey != "" {
+			canonical[p.Prefix+p.AlternativeKey] = p.Prefix + p.Key
+		}
+	}
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if c, ok := canonical[key]; ok {
+			key = c
+		}
+		params = append(params, key)
+	}
+	return params
+}
@@ -16,15 +16,24 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
 	"github.com/mark3labs/mcp-go/server"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/discoverer"
 	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgetmanager"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/policy"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/tools/compact"
 	gadgetsdefault "github.com/inspektor-gadget/ig-mcp-server/pkg/tools/gadgets/default"
 	gadgetsephemeral "github.com/inspektor-gadget/ig-mcp-server/pkg/tools/gadgets/ephemeral"
 	lifecycledeploy "github.com/inspektor-gadget/ig-mcp-server/pkg/tools/lifecycle/deploy"
@@ -33,6 +42,24 @@ import (
 
 var log = slog.Default().With("component", "tools")
 
+var (
+	// ErrNotAvailable is returned for gadget infos while Inspektor Gadget isn't available
+	ErrNotAvailable = errors.New("inspektor gadget is not available")
+	// ErrUnknownGadget is returned for gadget infos of gadgets not known to the registry
+	ErrUnknownGadget = errors.New("unknown gadget")
+)
+
+// Tool modes
+const (
+	// ToolModeFull exposes one tool per gadget
+	ToolModeFull = "full"
+	// ToolModeCompact exposes the gadgets through the ig_catalog and ig_run tools
+	ToolModeCompact = "compact"
+)
+
+// ToolModes lists the supported tool modes.
+var ToolModes = []string{ToolModeFull, ToolModeCompact}
+
 type ToolRegistryCallback func(tool ...server.ServerTool)
 
 // GadgetToolRegistry is a simple registry for server tools based on gadgets.
@@ -46,18 +73,77 @@ type GadgetToolRegistry struct {
 	k8sConfig  *genericclioptions.ConfigFlags
 	discoverer discoverer.Discoverer
 	env        string
+	filter     *ToolFilter
+	mode       string
+	// gadgetNamespace is the namespace the gadget pods are watched in
+	gadgetNamespace string
+	// policy is read by the tool handlers without holding mu, it's only replaced under mu
+	policy atomic.Pointer[policy.Policy]
+
+	// gadgets holds the gadgets found by Prepare
+	gadgets []discoverer.Gadget
+	// infos holds the infos of the gadgets by name while Inspektor Gadget is available
+	infos map[string]*api.GadgetInfo
+	// imageInfos holds the same infos by the image of the gadgets
+	imageInfos map[string]*api.GadgetInfo
+	// available tells if the tools were built for a reachable Inspektor Gadget
+	available bool
+	prepared  bool
+	// refresh serializes Prepare and update, which fetch the gadget infos without holding mu
+	refresh sync.Mutex
+}
+
+// Option configures a GadgetToolRegistry.
+type Option func(*GadgetToolRegistry)
+
+// WithToolFilter only exposes the tools passing the given filter.
+func WithToolFilter(filter *ToolFilter) Option {
+	return func(r *GadgetToolRegistry) {
+		r.filter = filter
+	}
+}
+
+// WithToolMode sets how gadgets are exposed, one of ToolModes.
+func WithToolMode(mode string) Option {
+	return func(r *GadgetToolRegistry) {
+		r.mode = mode
+	}
+}
+
+// WithGadgetNamespace sets the namespace Inspektor Gadget is deployed in, the
+// gadget pods are only watched there. Defaults to gadget.
+func WithGadgetNamespace(namespace string) Option {
+	return func(r *GadgetToolRegistry) {
+		r.gadgetNamespace = namespace
+	}
 }
 
 // NewToolRegistry creates a new GadgetToolRegistry instance.
-func NewToolRegistry(manager gadgetmanager.GadgetManager, env string, k8sConfig *genericclioptions.ConfigFlags, discoverer discoverer.Discoverer, readonly bool) *GadgetToolRegistry {
-	return &GadgetToolRegistry{
+func NewToolRegistry(manager gadgetmanager.GadgetManager, env string, k8sConfig *genericclioptions.ConfigFlags, discoverer discoverer.Discoverer, readonly bool, opts ...Option) *GadgetToolRegistry {
+	r := &GadgetToolRegistry{
 		tools:      make(map[string]server.ServerTool),
+		infos:      make(map[string]*api.GadgetInfo),
 		gadgetMgr:  manager,
 		env:        env,
 		k8sConfig:  k8sConfig,
 		discoverer: discoverer,
 		readonly:   readonly,
+		mode:       ToolModeFull,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Environment returns the environment the tools are built for.
+func (r *GadgetToolRegistry) Environment() string {
+	return r.env
+}
+
+// ToolMode returns how gadgets are exposed, one of ToolModes.
+func (r *GadgetToolRegistry) ToolMode() string {
+	return r.mode
 }
 
 func (r *GadgetToolRegistry) all() []server.ServerTool {
@@ -67,6 +153,9 @@ func (r *GadgetToolRegistry) all() []server.ServerTool {
 			// If the registry is in read-only mode, skip tools that do not have the read-only hint annotation
 			continue
 		}
+		if !r.filter.Allowed(tool.Tool.Name) || !r.policy.Load().ToolAllowed(tool.Tool.Name) {
+			continue
+		}
 		tools = append(tools, tool)
 	}
 	return tools
@@ -77,7 +166,16 @@ func (r *GadgetToolRegistry) RegisterTools(tools ...server.ServerTool) {
 		log.Debug("Registering tool", "name", tool.Tool.Name)
 		r.tools[tool.Tool.Name] = tool
 	}
+	r.notify()
+}
 
+// setTools replaces all registered tools.
+func (r *GadgetToolRegistry) setTools(tools ...server.ServerTool) {
+	clear(r.tools)
+	r.RegisterTools(tools...)
+}
+
+func (r *GadgetToolRegistry) notify() {
 	for _, callback := range r.callbacks {
 		log.Debug("Invoking tool registry callback", "tools_count", len(r.tools))
 		callback(r.all()...)
@@ -89,8 +187,8 @@ func (r *GadgetToolRegistry) RegisterCallback(callback ToolRegistryCallback) {
 }
 
 func (r *GadgetToolRegistry) Prepare(ctx context.Context, images []string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	r.refresh.Lock()
+	defer r.refresh.Unlock()
 
 	gadgets := discoverer.FromImages(images)
 
@@ -111,58 +209,215 @@ func (r *GadgetToolRegistry) Prepare(ctx context.Context, images []string) error
 		}
 	}
 
-	var tools []server.ServerTool
-	// Register gadgets lifecycle tools and environment-specific tools
+	available := r.isAvailable(ctx)
+	infos := r.gadgetInfos(ctx, gadgets, available)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gadgets = gadgets
+	r.available = available
+	r.setInfos(infos)
+	r.prepared = true
+
+	// Register all tools in the registry
+	r.setTools(r.getTools(ctx)...)
+
+	return nil
+}
+
+// update rebuilds the tools if the availability of Inspektor Gadget changed.
+func (r *GadgetToolRegistry) update(ctx context.Context, available bool) {
+	r.refresh.Lock()
+	defer r.refresh.Unlock()
+
+	r.mu.Lock()
+	if !r.prepared || r.available == available {
+		r.mu.Unlock()
+		return
+	}
+	gadgets := r.gadgets
+	r.mu.Unlock()
+
+	log.Info("Inspektor Gadget availability changed, refreshing tools", "available", available)
+	infos := r.gadgetInfos(ctx, gadgets, available)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.available = available
+	r.setInfos(infos)
+	r.setTools(r.getTools(ctx)...)
+}
+
+// gadgetInfos fetches the infos of the gadgets by their image if Inspektor Gadget is
+// available. It's called without holding mu, as it can take a while.
+func (r *GadgetToolRegistry) gadgetInfos(ctx context.Context, gadgets []discoverer.Gadget, available bool) map[string]*api.GadgetInfo {
+	if !available {
+		return nil
+	}
+	return gadgetsdefault.GetGadgetInfos(ctx, r.gadgetMgr, r.env, gadgets)
+}
+
+// setInfos replaces the infos of the gadgets the tools are built from.
+func (r *GadgetToolRegistry) setInfos(infos map[string]*api.GadgetInfo) {
+	r.imageInfos = infos
+	clear(r.infos)
+	for image, info := range infos {
+		name, err := discoverer.GadgetName(image)
+		if err != nil {
+			log.Warn("Failed to get gadget name from image", "image", image, "error", err)
+			continue
+		}
+		r.infos[name] = info
+	}
+}
+
+// isAvailable checks if Inspektor Gadget can run gadgets.
+func (r *GadgetToolRegistry) isAvailable(ctx context.Context) bool {
 	if r.env == "kubernetes" {
-		tools = append(tools, r.getK8sTools(ctx, gadgets)...)
+		// use the same criterion as the pod watch, so that both agree on the availability
+		ready, err := r.gadgetPodsReady(ctx)
+		if err != nil {
+			log.Warn("Failed to check if Inspektor Gadget is deployed", "error", err)
+		}
+		return ready
 	}
-	if r.env == "linux" {
-		tools = append(tools, r.getLinuxTools(gadgets)...)
+	// Check if the ig daemon is running by getting its version
+	_, err := r.gadgetMgr.GetVersion()
+	if err != nil {
+		log.Warn("Failed to get ig daemon version", "error", err)
 	}
+	return err == nil
+}
 
-	// Register all tools in the registry
-	r.RegisterTools(tools...)
+// gadgetPodsReady returns true if at least one of the gadget pods is ready.
+func (r *GadgetToolRegistry) gadgetPodsReady(ctx context.Context) (bool, error) {
+	restConfig, err := r.k8sConfig.ToRESTConfig()
+	if err != nil {
+		return false, fmt.Errorf("creating REST config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return false, fmt.Errorf("creating kubernetes client: %w", err)
+	}
+	pods, err := client.CoreV1().Pods("").List(ctx, metav1.ListOptions{LabelSelector: gadgetPodSelector})
+	if err != nil {
+		return false, fmt.Errorf("listing gadget pods: %w", err)
+	}
+	var list []*corev1.Pod
+	for i := range pods.Items {
+		list = append(list, &pods.Items[i])
+	}
+	return anyPodReady(list), nil
+}
 
-	return nil
+func (r *GadgetToolRegistry) getTools(ctx context.Context) []server.ServerTool {
+	// Register gadgets lifecycle tools and environment-specific tools
+	var tools, gadgetTools []server.ServerTool
+	switch r.env {
+	case "kubernetes":
+		tools, gadgetTools = r.getK8sTools(ctx)
+	case "linux":
+		tools, gadgetTools = r.getLinuxTools(ctx)
+	default:
+		return nil
+	}
+
+	// compact mode only exposes the catalog and ig_run next to the lifecycle tools
+	if tool, ok := r.investigationTool(); ok && r.mode != ToolModeCompact {
+		tools = append(tools, tool)
+	}
+	tools = r.enforcePolicy(tools...)
+	gadgetTools = r.enforcePolicy(gadgetTools...)
+
+	if r.mode != ToolModeCompact {
+		return append(tools, gadgetTools...)
+	}
+	// the filter applies to the gadgets offered by the compact tools as well
+	gadgetTools = slices.DeleteFunc(gadgetTools, func(t server.ServerTool) bool {
+		return !r.filter.Allowed(t.Tool.Name)
+	})
+	// ig_run calls the wrapped gadget tools, so their calls are checked as well
+	return append(tools, r.enforcePolicy(compact.GetTools(gadgetTools, r.gadgetToolAllowed)...)...)
 }
 
-func (r *GadgetToolRegistry) getK8sTools(ctx context.Context, gadgets []discoverer.Gadget) []server.ServerTool {
+// gadgetToolAllowed returns true if a gadget tool is offered to the session of ctx
+// by the current policy and the tool filter of the session.
+func (r *GadgetToolRegistry) gadgetToolAllowed(ctx context.Context, name string) bool {
+	return r.policy.Load().ToolAllowed(name) && FilterFromContext(ctx).Allowed(name)
+}
+
+// getK8sTools returns the lifecycle and gadget tools for Kubernetes.
+func (r *GadgetToolRegistry) getK8sTools(ctx context.Context) ([]server.ServerTool, []server.ServerTool) {
 	var tools []server.ServerTool
 	// Register Gadget lifecycle tool
 	tools = append(tools, lifecyclegadgets.GetTool(r.gadgetMgr))
-	// Register Inspektor Gadget lifecycle tool since we are in Kubernetes
+	// Register Inspektor Gadget lifecycle tool since we are in Kubernetes. The gadget pods are
+	// watched, but check right away in case they're already ready after deploying.
 	toolRefresher := func() {
 		go func() {
-			tools = r.getK8sTools(ctx, gadgets)
-			r.RegisterTools(tools...)
+			r.update(ctx, r.isAvailable(ctx))
 		}()
 	}
 	tools = append(tools, lifecycledeploy.GetTool(toolRefresher))
-	deployed, _, err := lifecycledeploy.IsInspektorGadgetDeployed(ctx)
-	if err != nil {
-		log.Warn("Failed to check if Inspektor Gadget is deployed, skipping Inspektor Gadget lifecycle tool", "error", err)
-	}
 	// Register tools based on gadgets only if Inspektor Gadget is deployed
-	if deployed {
-		tools = append(tools, gadgetsdefault.GetTools(ctx, r.gadgetMgr, r.env, gadgets)...)
-	} else {
-		tools = append(tools, gadgetsephemeral.GetTools(gadgets)...)
-	}
-	return tools
+	return tools, r.gadgetTools()
 }
 
-func (r *GadgetToolRegistry) getLinuxTools(gadgets []discoverer.Gadget) []server.ServerTool {
+// getLinuxTools returns the lifecycle and gadget tools for Linux.
+func (r *GadgetToolRegistry) getLinuxTools(ctx context.Context) ([]server.ServerTool, []server.ServerTool) {
 	var tools []server.ServerTool
 	// Register Gadget lifecycle tool
 	tools = append(tools, lifecyclegadgets.GetTool(r.gadgetMgr))
 
-	// Check if the ig daemon is running by getting its version
-	_, err := r.gadgetMgr.GetVersion()
-	if err != nil {
-		log.Warn("Failed to get ig daemon version, skipping gadget lifecycle tools", "error", err)
-		return tools
+	if !r.available {
+		log.Warn("ig daemon is not reachable, registering placeholder gadget tools until it is")
 	}
+	return tools, r.gadgetTools()
+}
 
-	tools = append(tools, gadgetsdefault.GetTools(context.Background(), r.gadgetMgr, r.env, gadgets)...)
-	return tools
+// gadgetTools returns one tool per gadget if Inspektor Gadget is available and
+// placeholders otherwise.
+func (r *GadgetToolRegistry) gadgetTools() []server.ServerTool {
+	if !r.available {
+		return gadgetsephemeral.GetTools(r.env, r.gadgets)
+	}
+	return gadgetsdefault.GetTools(r.env, r.gadgetMgr, r.imageInfos)
+}
+
+// investigationTool returns the tool running several gadgets at once. It's only
+// available together with the gadgets it can run.
+func (r *GadgetToolRegistry) investigationTool() (server.ServerTool, bool) {
+	infos := make(map[string]*api.GadgetInfo)
+	for name, info := range r.infos {
+		// gadgets that are filtered out can't be run as part of an investigation either
+		if r.filter.Allowed(gadgetToolPrefix + name) {
+			infos[name] = info
+		}
+	}
+	if !r.available || len(infos) == 0 {
+		return server.ServerTool{}, false
+	}
+	return gadgetsdefault.GetInvestigationTool(r.gadgetMgr, infos), true
+}
+
+// Gadgets returns the gadgets found by Prepare.
+func (r *GadgetToolRegistry) Gadgets() []discoverer.Gadget {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.gadgets)
+}
+
+// GadgetInfo returns the info of a gadget by its name, e.g. trace_dns. It's only
+// available while Inspektor Gadget is.
+func (r *GadgetToolRegistry) GadgetInfo(name string) (*api.GadgetInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.available {
+		return nil, ErrNotAvailable
+	}
+	info, ok := r.infos[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownGadget, name)
+	}
+	return info, nil
 }
@@ -0,0 +1,335 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/gadgettest"
+	"github.com/inspektor-gadget/ig-mcp-server/pkg/policy"
+)
+
+const traceExecImage = "ghcr.io/inspektor-gadget/gadget/trace_exec:latest"
+
+func newManager(t *testing.T) *gadgettest.Manager {
+	t.Helper()
+	// keep the gadget info cache out of the home directory
+	t.Setenv("HOME", t.TempDir())
+
+	g := &gadgettest.Gadget{
+		Image:    traceExecImage,
+		Metadata: "name: trace_exec\ndescription: trace process executions\n",
+		DataSources: []gadgettest.DataSource{{
+			Name:   "exec",
+			Fields: []gadgettest.Field{{Name: "proc.comm", Kind: api.Kind_String}},
+		}},
+	}
+	info, err := g.Info()
+	if err != nil {
+		t.Fatalf("creating gadget info: %v", err)
+	}
+	return &gadgettest.Manager{
+		Version: "0.50.1",
+		// gadgets are fetched in the version of the daemon
+		Infos:   map[string]*api.GadgetInfo{"ghcr.io/inspektor-gadget/gadget/trace_exec:v0.50.1": info},
+		Results: map[string]string{info.ImageName: "\n<results>{\"proc\":{\"comm\":\"sh\"}}\n</results>\n"},
+	}
+}
+
+func prepare(t *testing.T, mgr *gadgettest.Manager, opts ...Option) (*GadgetToolRegistry, map[string]server.ServerTool) {
+	t.Helper()
+	registry := NewToolRegistry(mgr, "linux", nil, nil, true, opts...)
+	tools := make(map[string]server.ServerTool)
+	registry.RegisterCallback(func(registered ...server.ServerTool) {
+		clear(tools)
+		for _, tool := range registered {
+			tools[tool.Tool.Name] = tool
+		}
+	})
+	if err := registry.Prepare(context.Background(), []string{traceExecImage}); err != nil {
+		t.Fatalf("preparing registry: %v", err)
+	}
+	return registry, tools
+}
+
+func TestPrepareLinux(t *testing.T) {
+	mgr := newManager(t)
+	_, tools := prepare(t, mgr)
+
+	names := slices.Sorted(maps.Keys(tools))
+	if want := []string{"gadget_trace_exec", "ig_gadgets", "ig_investigate"}; !slices.Equal(names, want) {
+		t.Fatalf("expected tools %v, got %v", want, names)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"params": map[string]any{}, "duration": float64(1)}
+	res, err := tools["gadget_trace_exec"].Handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("calling tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("expected the tool to succeed, got %v", res.Content)
+	}
+	if text := res.Content[0].(mcp.TextContent).Text; text != mgr.Results[traceExecImage] {
+		t.Errorf("expected the results of the gadget, got %q", text)
+	}
+}
+
+func TestPrepareLinuxWithoutDaemon(t *testing.T) {
+	mgr := newManager(t)
+	mgr.Version = ""
+	_, tools := prepare(t, mgr)
+
+	if len(tools) != 2 {
+		t.Fatalf("expected the lifecycle and a placeholder tool without a daemon, got %d tools", len(tools))
+	}
+	res, err := tools["gadget_trace_exec"].Handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("calling tool: %v", err)
+	}
+	if !res.IsError {
+		t.Error("expected the placeholder tool to fail")
+	}
+	if calls := mgr.Calls(); slices.ContainsFunc(calls, func(c gadgettest.Call) bool { return c.Method == "Run" }) {
+		t.Error("expected the placeholder tool not to run the gadget")
+	}
+}
+
+func TestPrepareCompact(t *testing.T) {
+	mgr := newManager(t)
+	_, tools := prepare(t, mgr, WithToolMode(ToolModeCompact))
+
+	names := slices.Sorted(maps.Keys(tools))
+	if want := []string{"ig_catalog", "ig_gadgets", "ig_run"}; !slices.Equal(names, want) {
+		t.Fatalf("expected tools %v, got %v", want, names)
+	}
+
+	call := func(name string, args map[string]any) string {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		res, err := tools[name].Handler(context.Background(), req)
+		if err != nil {
+			t.Fatalf("calling %s: %v", name, err)
+		}
+		text := res.Content[0].(mcp.TextContent).Text
+		if res.IsError {
+			t.Fatalf("expected %s to succeed, got %s", name, text)
+		}
+		return text
+	}
+
+	if text := call("ig_catalog", map[string]any{"query": "process"}); !strings.Contains(text, "- trace_exec: ") {
+		t.Errorf("expected the search to find trace_exec, got %q", text)
+	}
+	if text := call("ig_catalog", map[string]any{"query": "dns"}); strings.Contains(text, "trace_exec") {
+		t.Errorf("expected the search not to find trace_exec, got %q", text)
+	}
+	// fields are only described on demand
+	if text := call("ig_catalog", map[string]any{"gadget": "trace_exec"}); !strings.Contains(text, "proc.comm") {
+		t.Errorf("expected the description of trace_exec with its fields, got %q", text)
+	}
+
+	if text := call("ig_run", map[string]any{"gadget": "trace_exec", "duration": float64(1)}); text != mgr.Results[traceExecImage] {
+		t.Errorf("expected the results of the gadget, got %q", text)
+	}
+	call("ig_run", map[string]any{"gadget": "gadget_trace_exec", "duration": float64(1), "arguments": map[string]any{"max_events": float64(1)}})
+	calls := slices.DeleteFunc(mgr.Calls(), func(c gadgettest.Call) bool { return c.Method != "Run" })
+	if len(calls) != 2 || calls[1].Options != calls[0].Options+1 {
+		t.Errorf("expected the arguments to be passed to the gadget, got calls %+v", calls)
+	}
+
+	// gadgets disabled for the session aren't offered by the catalog
+	filter, err := ParseToolFilter("", "gadget_trace_exec")
+	if err != nil {
+		t.Fatalf("parsing filter: %v", err)
+	}
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"gadget": "trace_exec"}
+	res, err := tools["ig_catalog"].Handler(ContextWithFilter(context.Background(), filter), req)
+	if err != nil {
+		t.Fatalf("calling ig_catalog: %v", err)
+	}
+	if !res.IsError {
+		t.Errorf("expected the gadget disabled for the session to be unknown, got %v", res.Content)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	parse := func(data string) *policy.Policy {
+		t.Helper()
+		p, err := policy.Parse([]byte(data))
+		if err != nil {
+			t.Fatalf("parsing policy: %v", err)
+		}
+		return p
+	}
+	call := func(tools map[string]server.ServerTool, name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = args
+		res, err := tools[name].Handler(context.Background(), req)
+		if err != nil {
+			t.Fatalf("calling %s: %v", name, err)
+		}
+		return res
+	}
+	blocked := func(res *mcp.CallToolResult) bool {
+		return res.IsError && strings.HasPrefix(res.Content[0].(mcp.TextContent).Text, "policy violation: ")
+	}
+
+	mgr := newManager(t)
+	registry, tools := prepare(t, mgr, WithPolicy(parse("deny: [ig_gadgets stop_gadget]\nmaxDuration: 5s\n")))
+
+	if res := call(tools, "ig_gadgets", map[string]any{"action": "stop_gadget", "gadget_id": "1"}); !blocked(res) {
+		t.Errorf("expected stopping gadgets to be blocked, got %v", res.Content)
+	}
+	if res := call(tools, "ig_gadgets", map[string]any{"action": "list_running_gadgets"}); res.IsError {
+		t.Errorf("expected listing gadgets to be allowed, got %v", res.Content)
+	}
+	// the default duration exceeds the maximum
+	if res := call(tools, "gadget_trace_exec", map[string]any{"params": map[string]any{}}); !blocked(res) {
+		t.Errorf("expected the gadget run to be blocked, got %v", res.Content)
+	}
+	if res := call(tools, "ig_investigate", map[string]any{"gadgets": []any{map[string]any{"gadget": "trace_exec"}}, "duration": float64(30)}); !blocked(res) {
+		t.Errorf("expected the investigation to be blocked, got %v", res.Content)
+	}
+	if calls := mgr.Calls(); slices.ContainsFunc(calls, func(c gadgettest.Call) bool { return c.Method == "Run" || c.Method == "Stop" }) {
+		t.Errorf("expected blocked calls not to reach the gadget manager, got %+v", calls)
+	}
+	if res := call(tools, "gadget_trace_exec", map[string]any{"params": map[string]any{}, "duration": float64(1)}); res.IsError {
+		t.Errorf("expected the gadget run to be allowed, got %v", res.Content)
+	}
+
+	// the policy is reloaded
+	registry.SetPolicy(parse("deny: [gadget_trace_exec]\n"))
+	if _, ok := tools["gadget_trace_exec"]; ok {
+		t.Error("expected the denied tool to be removed")
+	}
+	if res := call(tools, "ig_gadgets", map[string]any{"action": "stop_gadget", "gadget_id": "1"}); blocked(res) {
+		t.Errorf("expected stopping gadgets to be allowed after the reload, got %v", res.Content)
+	}
+
+	// ig_run is subject to the rules of the gadget it runs
+	_, compactTools := prepare(t, newManager(t), WithToolMode(ToolModeCompact), WithPolicy(parse("params: {gadget_*: [operator.filter.*]}\n")))
+	if res := call(compactTools, "ig_run", map[string]any{"gadget": "trace_exec", "params": map[string]any{"operator.oci.ebpf.map-fetch-interval": "1s"}}); !blocked(res) {
+		t.Errorf("expected setting the param to be blocked, got %v", res.Content)
+	}
+	// the catalog doesn't offer gadgets the policy denies
+	_, compactTools = prepare(t, newManager(t), WithToolMode(ToolModeCompact), WithPolicy(parse("deny: [gadget_trace_exec]\n")))
+	if res := call(compactTools, "ig_catalog", map[string]any{}); strings.Contains(res.Content[0].(mcp.TextContent).Text, "trace_exec") {
+		t.Errorf("expected the denied gadget not to be listed, got %v", res.Content)
+	}
+}
+
+func TestUpdateLinux(t *testing.T) {
+	mgr := newManager(t)
+	mgr.Version = ""
+	registry, tools := prepare(t, mgr)
+
+	call := func() *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]any{"params": map[string]any{}, "duration": float64(1)}
+		res, err := tools["gadget_trace_exec"].Handler(context.Background(), req)
+		if err != nil {
+			t.Fatalf("calling tool: %v", err)
+		}
+		return res
+	}
+
+	// the daemon becomes reachable
+	mgr.Version = "0.50.1"
+	registry.update(context.Background(), true)
+	if res := call(); res.IsError {
+		t.Errorf("expected the gadget tool to replace the placeholder, got %v", res.Content)
+	}
+
+	// and goes away again
+	registry.update(context.Background(), false)
+	if res := call(); !res.IsError {
+		t.Errorf("expected the placeholder to replace the gadget tool, got %v", res.Content)
+	}
+}
+
+func TestUpdateDoesNotBlock(t *testing.T) {
+	mgr := newManager(t)
+	mgr.Version = ""
+	registry, _ := prepare(t, mgr)
+
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	infos := mgr.Infos
+	mgr.InfoFunc = func(ctx context.Context, image string) (*api.GadgetInfo, error) {
+		close(fetching)
+		<-release
+		return infos[image], nil
+	}
+	mgr.Version = "0.50.1"
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		registry.update(context.Background(), true)
+	}()
+	<-fetching
+
+	// the registry can be used while the gadget infos are fetched
+	got := make(chan error)
+	go func() {
+		_, err := registry.GadgetInfo("trace_exec")
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		if !errors.Is(err, ErrNotAvailable) {
+			t.Errorf("expected Inspektor Gadget to be unavailable until the refresh is done, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected GadgetInfo not to wait for the refresh")
+	}
+	close(release)
+	<-done
+	if _, err := registry.GadgetInfo("trace_exec"); err != nil {
+		t.Errorf("expected the gadget info once the refresh is done, got %v", err)
+	}
+}
+
+func TestAnyPodReady(t *testing.T) {
+	pod := func(phase corev1.PodPhase, ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{Status: corev1.PodStatus{
+			Phase:      phase,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+		}}
+	}
+	deleted := pod(corev1.PodRunning, corev1.ConditionTrue)
+	deleted.DeletionTimestamp = &metav1.Time{}
+
+	tests := []struct {
+		name string
+		pods []*corev1.Pod
+		want bool
+	}{
+		{name: "no pods", want: false},
+		{name: "pending", pods: []*corev1.Pod{pod(corev1.PodPending, corev1.ConditionFalse)}, want: false},
+		{name: "not ready", pods: []*corev1.Pod{pod(corev1.PodRunning, corev1.ConditionFalse)}, want: false},
+		{name: "terminating", pods: []*corev1.Pod{deleted}, want: false},
+		{name: "one ready", pods: []*corev1.Pod{pod(corev1.PodRunning, corev1.ConditionFalse), pod(corev1.PodRunning, corev1.ConditionTrue)}, want: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := anyPodReady(tc.pods); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// gadgetPodSelector selects the pods of the Inspektor Gadget daemonset
+	gadgetPodSelector = "k8s-app=gadget"
+	// defaultGadgetNamespace is the namespace the gadget pods are watched in if none is configured
+	defaultGadgetNamespace = "gadget"
+	// podSyncTimeout is the time to wait for the first list of gadget pods before polling instead
+	podSyncTimeout = 30 * time.Second
+	// pollInterval is the interval Inspektor Gadget is checked at if it can't be watched
+	pollInterval = 10 * time.Second
+)
+
+// Watch keeps the tools in sync with the availability of Inspektor Gadget until
+// ctx is done. In kubernetes the gadget pods in the gadget namespace are watched,
+// in linux or if the pods can't be watched Inspektor Gadget is polled. Once
+// Inspektor Gadget becomes available the ephemeral tools are replaced with the
+// gadget tools and the other way around once it's gone, notifying connected
+// clients that the tool list changed.
+func (r *GadgetToolRegistry) Watch(ctx context.Context) error {
+	switch r.env {
+	case "kubernetes":
+		return r.watchGadgetPods(ctx)
+	case "linux":
+		r.poll(ctx)
+		return nil
+	}
+	return fmt.Errorf("unsupported environment: %s", r.env)
+}
+
+func (r *GadgetToolRegistry) watchGadgetPods(ctx context.Context) error {
+	restConfig, err := r.k8sConfig.ToRESTConfig()
+	if err != nil {
+		return fmt.Errorf("creating REST config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("creating kubernetes client: %w", err)
+	}
+
+	namespace := r.gadgetNamespace
+	if namespace == "" {
+		namespace = defaultGadgetNamespace
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = gadgetPodSelector
+		}),
+	)
+	pods := factory.Core().V1().Pods()
+
+	// coalesce bursts of pod events, the tools are only rebuilt if the availability changed
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	_, err = pods.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { notify() },
+		UpdateFunc: func(any, any) { notify() },
+		DeleteFunc: func(any) { notify() },
+	})
+	if err != nil {
+		return fmt.Errorf("watching gadget pods: %w", err)
+	}
+	// keep the last error to tell why watching failed, e.g. if the watch verb isn't granted
+	var watchErr atomic.Pointer[error]
+	err = pods.Informer().SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		log.Debug("Failed to watch gadget pods", "error", err)
+		watchErr.Store(&err)
+	})
+	if err != nil {
+		return fmt.Errorf("watching gadget pods: %w", err)
+	}
+
+	informerCtx, cancel := context.WithCancel(ctx)
+	factory.Start(informerCtx.Done())
+	defer func() {
+		cancel()
+		factory.Shutdown()
+	}()
+
+	syncCtx, syncCancel := context.WithTimeout(informerCtx, podSyncTimeout)
+	synced := cache.WaitForCacheSync(syncCtx.Done(), pods.Informer().HasSynced)
+	syncCancel()
+	if !synced {
+		if ctx.Err() != nil {
+			return nil
+		}
+		var cause error
+		if err := watchErr.Load(); err != nil {
+			cause = *err
+		}
+		log.Warn("Failed to watch gadget pods, polling Inspektor Gadget instead", "namespace", namespace, "error", cause)
+		cancel()
+		factory.Shutdown()
+		r.poll(ctx)
+		return nil
+	}
+
+	log.Info("Watching Inspektor Gadget pods to refresh the tools", "namespace", namespace, "selector", gadgetPodSelector)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+		list, err := pods.Lister().List(labels.Everything())
+		if err != nil {
+			log.Warn("Failed to list gadget pods", "error", err)
+			continue
+		}
+		r.update(ctx, anyPodReady(list))
+	}
+}
+
+// anyPodReady returns true if at least one of the pods is ready to serve gadgets.
+func anyPodReady(pods []*corev1.Pod) bool {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *GadgetToolRegistry) poll(ctx context.Context) {
+	log.Info("Polling Inspektor Gadget to refresh the tools", "interval", pollInterval)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		_, err := r.gadgetMgr.GetVersion()
+		r.update(ctx, err == nil)
+	}
+}